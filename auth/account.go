@@ -0,0 +1,217 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	Store "ninetynine/store"
+	Throttle "ninetynine/throttle"
+)
+
+var (
+	ErrWrongPassword = errors.New("wrong password")
+	ErrRecentSignIn  = errors.New("sign in again to confirm")
+)
+
+// TooManyPasswordsError is returned while password checks for an account are
+// throttled, Locked is set during a lockout
+type TooManyPasswordsError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *TooManyPasswordsError) Error() string {
+	return "too many password attempts"
+}
+
+// recentSignIn is how long after signing in a user without a password may
+// make sensitive changes
+const recentSignIn = 5 * time.Minute
+
+// Confirmation is what a signed in user sends to confirm a sensitive change.
+// Accounts with a password confirm with it. Accounts without one send a
+// Firebase ID token of the linked account from a recent sign in, or use a
+// session that signed in recently.
+type Confirmation struct {
+	SessionId string
+	Password  string
+	IdToken   string
+}
+
+// ConfirmUser checks the confirmation of a signed in user before a sensitive
+// change and returns the user
+func ConfirmUser(userId string, confirmation Confirmation) (Store.User, error) {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	if user.Password != "" {
+		if err := checkPassword(user, confirmation.Password); err != nil {
+			return Store.User{}, err
+		}
+		return user, nil
+	}
+
+	since := time.Now().Add(-recentSignIn).Unix()
+	if confirmation.IdToken != "" && idTokenVerifier != nil {
+		identity, err := idTokenVerifier.VerifyIDToken(confirmation.IdToken)
+		if errors.Is(err, ErrInvalidToken) {
+			return Store.User{}, ErrRecentSignIn
+		}
+		if err != nil {
+			return Store.User{}, err
+		}
+		if user.FirebaseUid == "" || identity.UID != user.FirebaseUid || identity.AuthTime < since {
+			return Store.User{}, ErrRecentSignIn
+		}
+		return user, nil
+	}
+
+	// a guest has nothing but its session to show
+	if user.IsGuest {
+		return user, nil
+	}
+
+	session, err := Store.DB.GetSession(confirmation.SessionId)
+	if errors.Is(err, Store.ErrNotFound) {
+		return Store.User{}, ErrRecentSignIn
+	}
+	if err != nil {
+		return Store.User{}, err
+	}
+	if session.UserId != userId || session.CreatedAt < since {
+		return Store.User{}, ErrRecentSignIn
+	}
+
+	return user, nil
+}
+
+// checkPassword verifies the password of a signed in user under the same
+// account limit as logins, so confirmations cannot be used to guess it
+func checkPassword(user Store.User, password string) error {
+	wait, locked, err := Throttle.CheckPassword(user.Email)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &TooManyPasswordsError{RetryAfter: wait, Locked: locked}
+	}
+
+	if ok, _ := verifyPassword(password, user.Password); ok {
+		return nil
+	}
+
+	lockedNow, err := Throttle.PasswordFailed(user.Email)
+	if err != nil {
+		return err
+	}
+	if lockedNow {
+		err = SendUnlockEmail(user.Email)
+		if err != nil {
+			fmt.Println("Error sending unlock email", err)
+		}
+	}
+	return ErrWrongPassword
+}
+
+// ChangePassword sets a new password after confirming the user, with the
+// current password if there is one, and signs the account out of every session.
+// Guests set their first password by upgrading.
+func ChangePassword(userId string, confirmation Confirmation, newPassword string) (Store.User, error) {
+	user, err := ConfirmUser(userId, confirmation)
+	if err != nil {
+		return Store.User{}, err
+	}
+	if user.IsGuest {
+		return Store.User{}, ErrGuest
+	}
+
+	user.Password = hashPassword(newPassword)
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	return user, revokeUserSessions(userId)
+}
+
+// DeleteAccount removes the user document and everything tied to it. Match
+// history is kept for the other players with the user replaced by an
+// anonymous one. Rooms are cleaned up separately by the room package.
+func DeleteAccount(userId string) error {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return err
+	}
+
+	err = Store.DB.AnonymizeMatchPlayer(userId, "deleted-"+randomToken()[:20], "Deleted user")
+	if err != nil {
+		return err
+	}
+
+	err = revokeUserSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	for _, purpose := range []string{"password_reset", "verify_email", "unlock_account"} {
+		err = Store.DB.DeleteUserTokens(userId, purpose)
+		if err != nil {
+			return err
+		}
+	}
+
+	if user.Email != "" {
+		err = Throttle.Unlock(user.Email)
+		if err != nil {
+			return err
+		}
+	}
+
+	return Store.DB.DeleteUser(userId)
+}
+
+type AccountExport struct {
+	ExportedAt  int64           `json:"exportedAt"`
+	User        Store.User      `json:"user"`
+	HasPassword bool            `json:"hasPassword"` // only a salted hash is stored
+	FirebaseUid string          `json:"firebaseUid,omitempty"`
+	Sessions    []Store.Session `json:"sessions"`
+	Rooms       []Store.Room    `json:"rooms"`
+	Matches     []Store.Match   `json:"matches"`
+}
+
+// ExportAccount collects everything stored about a user
+func ExportAccount(userId string) (AccountExport, error) {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	sessions, err := Store.DB.GetSessionsByUser(userId)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	rooms, err := Store.DB.GetRoomsByMember(userId)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	matches, err := Store.DB.GetMatchesByUser(userId)
+	if err != nil {
+		return AccountExport{}, err
+	}
+
+	return AccountExport{
+		ExportedAt:  time.Now().Unix(),
+		User:        user,
+		HasPassword: user.Password != "",
+		FirebaseUid: user.FirebaseUid,
+		Sessions:    sessions,
+		Rooms:       rooms,
+		Matches:     matches,
+	}, nil
+}
@@ -1,11 +1,10 @@
 package auth
 
 import (
-	"context"
-	Firebase "ninetynine/firebase"
+	"errors"
+	"fmt"
 
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	Store "ninetynine/store"
 )
 
 type AccountData struct {
@@ -14,34 +13,65 @@ type AccountData struct {
 	Username string `json:"username"`
 }
 
-func AccountSetting(data AccountData) (bool, map[string]interface{}, error) {
-	docRef := Firebase.FirestoreClient.Collection("users").Doc(data.UserId)
-	docSnap, err := docRef.Get(context.Background())
+// AccountSetting updates the username right away, failing with a
+// UsernameError if it breaks the username policy and with ErrUsernameTaken
+// if another account holds it. A new email is kept as
+// pending and only replaces the current one once it is verified. Guests get
+// ErrGuest for an email, they add one by upgrading.
+func AccountSetting(data AccountData) (bool, Store.User, error) {
+	user, err := Store.DB.GetUser(data.UserId)
 
-	if status.Code(err) == codes.NotFound {
-		return false, nil, nil
+	if errors.Is(err, Store.ErrNotFound) {
+		return false, Store.User{}, nil
 	}
 
 	if err != nil {
-		return false, nil, err
+		return false, Store.User{}, err
 	}
 
-	userData := docSnap.Data()
+	if data.Username != user.Username {
+		data.Username, err = CheckUsername(data.Username)
+		if err != nil {
+			return false, Store.User{}, err
+		}
+	}
 
-	userData["email"] = data.Email
-	userData["username"] = data.Username
+	if user.IsGuest && data.Email != user.Email {
+		return false, Store.User{}, ErrGuest
+	}
 
-	_, err = docRef.Set(context.Background(), userData)
-	if err != nil {
-		return false, nil, err
+	emailChanged := data.Email != user.Email && data.Email != user.PendingEmail
+	if emailChanged {
+		// checked again when the address is verified and actually claimed
+		owner, err := Store.DB.GetUserByEmail(data.Email)
+		if err == nil && owner.UserId != user.UserId {
+			return false, Store.User{}, ErrEmailTaken
+		}
+		if err != nil && !errors.Is(err, Store.ErrNotFound) {
+			return false, Store.User{}, err
+		}
 	}
 
-	userData["userId"] = data.UserId
+	if data.Email == user.Email {
+		user.PendingEmail = ""
+	} else {
+		user.PendingEmail = data.Email
+	}
+	user.Username = data.Username
 
-	return true, userData, nil
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return false, Store.User{}, err
+	}
 
-}
+	// the change is saved, the link can be sent again if the mail fails
+	if emailChanged {
+		err = SendVerificationEmail(user)
+		if err != nil {
+			fmt.Println("Error sending verification email", err)
+		}
+	}
+
+	return true, user, nil
 
-func resetPassword() {
-	// TODO: implement
 }
@@ -1,34 +1,35 @@
 package auth
 
 import (
-	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
+	"fmt"
 	"regexp"
 
-	Firebase "ninetynine/firebase"
+	Avatar "ninetynine/avatar"
+	Store "ninetynine/store"
+)
 
-	"google.golang.org/api/iterator"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+// the store enforces uniqueness when users are written, these are the errors
+// it returns when a name is already held by someone else
+var (
+	ErrEmailTaken    = Store.ErrEmailTaken
+	ErrUsernameTaken = Store.ErrUsernameTaken
 )
 
 func CheckUniqueEmail(email string) (bool, error) {
-	query := Firebase.FirestoreClient.Collection("users").Where("email", "==", email).Limit(1)
-	_, err := query.Documents(context.Background()).Next()
-	if err == iterator.Done {
+	_, err := Store.DB.GetUserByEmail(email)
+	if errors.Is(err, Store.ErrNotFound) {
 		return true, nil
 	}
-	if err != nil && err != iterator.Done {
+	if err != nil {
 		return false, err
 	}
 	return false, nil
 }
 
 func CheckUniqueUsername(username string) (bool, error) {
-	query := Firebase.FirestoreClient.Collection("users").Where("username", "==", username).Limit(1)
-	_, err := query.Documents(context.Background()).Next()
-	if err == iterator.Done {
+	_, err := Store.DB.GetUserByUsername(username)
+	if errors.Is(err, Store.ErrNotFound) {
 		return true, nil
 	}
 
@@ -39,46 +40,77 @@ func CheckUniqueUsername(username string) (bool, error) {
 	return false, nil
 }
 
-func CreateUser(userData map[string]interface{}) (map[string]interface{}, error) {
+func CreateUser(user Store.User) (Store.User, error) {
 	// hash password
-	userData["password"] = hashedPassword(userData["password"].(string))
+	user.Password = hashPassword(user.Password)
 
-	docRef, _, err := Firebase.FirestoreClient.Collection("users").Add(context.Background(), userData)
-	if err != nil {
-		return nil, err
+	return insertUser(user)
+}
+
+// insertUser stores a new user as a player and gives it the generated avatar
+// when it comes without a profile picture, the userId is only known once stored
+func insertUser(user Store.User) (Store.User, error) {
+	if user.Role == "" {
+		user.Role = RolePlayer
 	}
 
-	userData["userId"] = docRef.ID
+	user, err := Store.DB.CreateUser(user)
+	if err != nil || user.ProfilePic != "" {
+		return user, err
+	}
 
-	delete(userData, "password")
-	return userData, nil
+	user.ProfilePic = Avatar.DefaultURL(user.UserId)
+	return user, Store.DB.UpdateUser(user)
 }
 
-func Login(email string, password string) (bool, map[string]interface{}, error) {
-	query := Firebase.FirestoreClient.Collection("users").Where("email", "==", email).Limit(1)
-	docSnap, err := query.Documents(context.Background()).Next()
-	if err == iterator.Done {
-		return false, nil, nil
+// insertWithUsername stores a user under an available username derived from
+// base, picking again if a concurrent registration took it in between
+func insertWithUsername(user Store.User, base string) (Store.User, error) {
+	for attempt := 0; attempt < 3; attempt++ {
+		username, err := availableUsername(base)
+		if err != nil {
+			return Store.User{}, err
+		}
+
+		user.Username = username
+		created, err := insertUser(user)
+		if !errors.Is(err, ErrUsernameTaken) {
+			return created, err
+		}
+	}
+
+	return Store.User{}, ErrUsernameTaken
+}
+
+func Login(email string, password string) (bool, Store.User, error) {
+	user, err := Store.DB.GetUserByEmail(email)
+	if errors.Is(err, Store.ErrNotFound) {
+		return false, Store.User{}, nil
 	}
 	if err != nil {
-		return false, nil, err
+		return false, Store.User{}, err
 	}
 
-	userData := docSnap.Data()
-	if userData["password"] != hashedPassword(password) {
-		return false, nil, nil
+	ok, needsRehash := verifyPassword(password, user.Password)
+	if !ok {
+		return false, Store.User{}, nil
 	}
 
-	userData["userId"] = docSnap.Ref.ID
+	// migrate legacy sha256 hashes now that we know the plain password
+	if needsRehash {
+		user.Password = hashPassword(password)
+		err = Store.DB.UpdateUser(user)
+		if err != nil {
+			fmt.Println("Error rehashing password", err)
+		}
+	}
 
-	delete(userData, "password")
-	return true, userData, nil
+	return true, user, nil
 }
 
 func IsValidUserId(userId string) (bool, error) {
-	docRef := Firebase.FirestoreClient.Collection("users").Doc(userId)
-	_, err := docRef.Get(context.Background())
-	if status.Code(err) == codes.NotFound {
+	_, err := Store.DB.GetUser(userId)
+	if errors.Is(err, Store.ErrNotFound) {
 		return false, nil
 	}
 	if err != nil {
@@ -87,13 +119,6 @@ func IsValidUserId(userId string) (bool, error) {
 	return true, nil
 }
 
-func hashedPassword(password string) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(password))
-	hashed := hasher.Sum(nil)
-	return hex.EncodeToString(hashed)
-}
-
 func IsValidEmail(email string) bool {
 	emailRegex := `^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`
 	match, _ := regexp.MatchString(emailRegex, email)
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	Mail "ninetynine/mail"
+	Store "ninetynine/store"
+)
+
+// appURL is the frontend address used to build links in emails
+var appURL = "http://localhost:3000"
+
+func SetAppURL(url string) {
+	if url != "" {
+		appURL = url
+	}
+}
+
+// sendTokenEmail creates a single use token for the user and mails the link
+// to it. Older tokens with the same purpose are discarded first.
+func sendTokenEmail(user Store.User, to string, purpose string, data string, ttl time.Duration,
+	path string, subject string, body string) error {
+	err := Store.DB.DeleteUserTokens(user.UserId, purpose)
+	if err != nil {
+		return err
+	}
+
+	secret := randomToken()
+	now := time.Now()
+
+	err = Store.DB.CreateToken(Store.Token{
+		TokenHash: hashToken(secret),
+		UserId:    user.UserId,
+		Purpose:   purpose,
+		Data:      data,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := appURL + path + "?token=" + secret
+	return Mail.Client.Send(to, subject, "Hi "+user.Username+",\n\n"+body+"\n\n"+link+"\n")
+}
+
+// consumeToken redeems a token sent by sendTokenEmail, ok is false when the
+// token is unknown, already used or expired
+func consumeToken(secret string, purpose string) (Store.Token, bool, error) {
+	token, err := Store.DB.ConsumeToken(hashToken(secret), purpose)
+	if errors.Is(err, Store.ErrNotFound) {
+		return Store.Token{}, false, nil
+	}
+	if err != nil {
+		return Store.Token{}, false, err
+	}
+
+	if token.ExpiresAt < time.Now().Unix() {
+		return Store.Token{}, false, nil
+	}
+
+	return token, true, nil
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	Store "ninetynine/store"
+)
+
+const emailVerificationTTL = 24 * time.Hour
+
+// SendVerificationEmail mails a confirmation link to the user's pending
+// address, or to the current one if it is not verified yet
+func SendVerificationEmail(user Store.User) error {
+	email := user.PendingEmail
+	if email == "" {
+		if user.EmailVerified {
+			return nil
+		}
+		email = user.Email
+	}
+
+	return sendTokenEmail(user, email, "verify_email", email, emailVerificationTTL,
+		"/email/verify", "Confirm your email",
+		"Open the link below within 24 hours to confirm this email address for your ninetynine account.")
+}
+
+// VerifyEmail confirms the address a verification token was sent to. A
+// pending address replaces the current one, as long as no other account took
+// it in the meantime. It returns false if the token is not valid.
+func VerifyEmail(token string) (bool, Store.User, error) {
+	verifyToken, ok, err := consumeToken(token, "verify_email")
+	if err != nil || !ok {
+		return false, Store.User{}, err
+	}
+
+	user, err := Store.DB.GetUser(verifyToken.UserId)
+	if errors.Is(err, Store.ErrNotFound) {
+		return false, Store.User{}, nil
+	}
+	if err != nil {
+		return false, Store.User{}, err
+	}
+
+	email := verifyToken.Data
+	switch email {
+	case user.Email:
+		user.EmailVerified = true
+	case user.PendingEmail:
+		// claiming the address fails with ErrEmailTaken if another account took it in the meantime
+		user.Email = email
+		user.PendingEmail = ""
+		user.EmailVerified = true
+	default:
+		// the address changed again after this token was sent
+		return false, Store.User{}, nil
+	}
+
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return false, Store.User{}, err
+	}
+
+	return true, user, nil
+}
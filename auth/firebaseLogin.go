@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	Store "ninetynine/store"
+
+	fbauth "firebase.google.com/go/auth"
+)
+
+var ErrFirebaseLoginDisabled = errors.New("firebase login is not enabled")
+
+// Identity is what we use from a verified Firebase ID token
+type Identity struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+	Provider      string // google.com, apple.com, anonymous, ...
+	AuthTime      int64  // when the user signed in to Firebase
+}
+
+// IDTokenVerifier checks a Firebase ID token. Tests can swap in a fake.
+type IDTokenVerifier interface {
+	VerifyIDToken(idToken string) (Identity, error)
+}
+
+var idTokenVerifier IDTokenVerifier
+
+func SetIDTokenVerifier(verifier IDTokenVerifier) {
+	idTokenVerifier = verifier
+}
+
+type FirebaseVerifier struct {
+	client *fbauth.Client
+}
+
+func NewFirebaseVerifier(client *fbauth.Client) *FirebaseVerifier {
+	return &FirebaseVerifier{client: client}
+}
+
+func (v *FirebaseVerifier) VerifyIDToken(idToken string) (Identity, error) {
+	token, err := v.client.VerifyIDToken(context.Background(), idToken)
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+
+	identity := Identity{
+		UID:      token.UID,
+		Provider: token.Firebase.SignInProvider,
+		AuthTime: token.AuthTime,
+	}
+	identity.Email, _ = token.Claims["email"].(string)
+	identity.EmailVerified, _ = token.Claims["email_verified"].(bool)
+	identity.Name, _ = token.Claims["name"].(string)
+	identity.Picture, _ = token.Claims["picture"].(string)
+
+	return identity, nil
+}
+
+// FirebaseLogin signs in with a Firebase ID token. The Firebase account is
+// matched by uid, then linked to an existing user with the same verified
+// email, and otherwise a new user is created for it.
+func FirebaseLogin(idToken string) (Store.User, error) {
+	if idTokenVerifier == nil {
+		return Store.User{}, ErrFirebaseLoginDisabled
+	}
+
+	identity, err := idTokenVerifier.VerifyIDToken(idToken)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	if identity.UID == "" {
+		return Store.User{}, ErrInvalidToken
+	}
+
+	user, err := Store.DB.GetUserByFirebaseUid(identity.UID)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, Store.ErrNotFound) {
+		return Store.User{}, err
+	}
+
+	emailTaken := false
+	if identity.Email != "" {
+		user, err := Store.DB.GetUserByEmail(identity.Email)
+		if err == nil {
+			// only link when Firebase proved the address belongs to the caller
+			if identity.EmailVerified {
+				return linkFirebase(user, identity)
+			}
+			emailTaken = true
+		} else if !errors.Is(err, Store.ErrNotFound) {
+			return Store.User{}, err
+		}
+	}
+
+	newUser := Store.User{
+		Email:         identity.Email,
+		CreatedAt:     time.Now().Unix(),
+		GameStat:      Store.GameStat{PlayCount: 0},
+		ProfilePic:    identity.Picture,
+		EmailVerified: identity.EmailVerified,
+		FirebaseUid:   identity.UID,
+	}
+
+	if emailTaken {
+		newUser.Email = ""
+		newUser.EmailVerified = false
+	}
+
+	// no password, the account can only sign in through Firebase until one is set
+	return insertWithUsername(newUser, usernameBase(identity))
+}
+
+// linkFirebase links a Firebase account to the user with its verified email.
+// When the user never verified that email, whoever registered it may not own
+// it, so the password, two-factor setup and sessions they set up are dropped
+// before the owner of the address gets the account.
+func linkFirebase(user Store.User, identity Identity) (Store.User, error) {
+	if !user.EmailVerified {
+		err := revokeUserSessions(user.UserId)
+		if err != nil {
+			return Store.User{}, err
+		}
+
+		user.Password = ""
+		user.TOTPEnabled = false
+		user.TOTPSecret = ""
+		user.TOTPLastStep = 0
+		user.RecoveryCodes = nil
+	}
+
+	user.FirebaseUid = identity.UID
+	user.EmailVerified = true
+	return user, Store.DB.UpdateUser(user)
+}
+
+// usernameBase derives a username from the display name or the email,
+// keeping room for the digits availableUsername may append
+func usernameBase(identity Identity) string {
+	if name := UsernameRules.sanitize(identity.Name, 4); name != "" {
+		return name
+	}
+
+	if local, _, found := strings.Cut(identity.Email, "@"); found {
+		if name := UsernameRules.sanitize(local, 4); name != "" {
+			return name
+		}
+	}
+
+	return "player"
+}
+
+// availableUsername returns base, or base with a number appended if taken.
+// Only the server picks base, so the reserved list does not apply.
+func availableUsername(base string) (string, error) {
+	username := base
+	for i := 0; i < 20; i++ {
+		_, err := UsernameRules.check(username, true)
+		if err != nil {
+			return "", err
+		}
+
+		isUnique, err := CheckUniqueUsername(username)
+		if err != nil {
+			return "", err
+		}
+		if isUnique {
+			return username, nil
+		}
+
+		username = fmt.Sprintf("%s%04d", base, rand.Intn(10000))
+	}
+
+	return "", fmt.Errorf("no username available for %q", base)
+}
@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	Avatar "ninetynine/avatar"
+	Room "ninetynine/room"
+	Store "ninetynine/store"
+)
+
+var (
+	ErrNotGuest = errors.New("user is not a guest")
+	ErrGuest    = errors.New("guests have to upgrade first")
+)
+
+// CreateGuest creates a temporary account with a generated username. It can
+// play like any other user and be upgraded with UpgradeGuest.
+func CreateGuest() (Store.User, error) {
+	return insertWithUsername(Store.User{
+		CreatedAt: time.Now().Unix(),
+		GameStat:  Store.GameStat{PlayCount: 0},
+		IsGuest:   true,
+	}, fmt.Sprintf("Guest%04d", rand.Intn(10000)))
+}
+
+// UpgradeGuest turns a guest into a full account. The userId stays the same
+// so stats and match history carry over. An empty username keeps the
+// generated one.
+func UpgradeGuest(userId string, email string, username string, password string) (Store.User, error) {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	if !user.IsGuest {
+		return Store.User{}, ErrNotGuest
+	}
+
+	isUniqueEmail, err := CheckUniqueEmail(email)
+	if err != nil {
+		return Store.User{}, err
+	}
+	if !isUniqueEmail {
+		return Store.User{}, ErrEmailTaken
+	}
+
+	if username != "" && username != user.Username {
+		username, err = CheckUsername(username)
+		if err != nil {
+			return Store.User{}, err
+		}
+
+		isUniqueUsername, err := CheckUniqueUsername(username)
+		if err != nil {
+			return Store.User{}, err
+		}
+		if !isUniqueUsername {
+			return Store.User{}, ErrUsernameTaken
+		}
+		user.Username = username
+	}
+
+	user.Email = email
+	user.EmailVerified = false
+	user.Password = hashPassword(password)
+	user.IsGuest = false
+
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	// the upgrade is done, the link can be sent again if the mail fails
+	err = SendVerificationEmail(user)
+	if err != nil {
+		fmt.Println("Error sending verification email", err)
+	}
+
+	return user, nil
+}
+
+// CleanupGuests deletes guests that were not upgraded within ttl the way
+// accounts are deleted, so rooms and matches keep no ids of missing users
+func CleanupGuests(ttl time.Duration) error {
+	guests, err := Store.DB.GetGuestsCreatedBefore(time.Now().Add(-ttl).Unix())
+	if err != nil {
+		return err
+	}
+
+	for _, guest := range guests {
+		err := Room.RemoveUserFromRooms(guest.UserId)
+		if err != nil {
+			return err
+		}
+
+		err = Avatar.Delete(guest.UserId)
+		if err != nil {
+			return err
+		}
+
+		err = DeleteAccount(guest.UserId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(guests) > 0 {
+		fmt.Println("Deleted", len(guests), "expired guests")
+	}
+	return nil
+}
+
+// StartGuestCleanup runs CleanupGuests every hour in the background
+func StartGuestCleanup(ttl time.Duration) {
+	go func() {
+		for {
+			err := CleanupGuests(ttl)
+			if err != nil {
+				fmt.Println("Error deleting expired guests", err)
+			}
+
+			time.Sleep(time.Hour)
+		}
+	}()
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// argon2id parameters for new hashes, stored in every encoded hash so they
+// can be raised later without breaking existing accounts
+const (
+	argonTime    uint32 = 3
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 2
+	argonKeyLen  uint32 = 32
+	argonSaltLen        = 16
+)
+
+// legacy hashes are a single unsalted hex encoded sha256
+var legacyHashRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// hashPassword returns an argon2id hash in the PHC string format
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func hashPassword(password string) string {
+	salt := make([]byte, argonSaltLen)
+	rand.Read(salt)
+
+	key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, argonMemory, argonTime, argonThreads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key))
+}
+
+// verifyPassword checks password against a stored hash. needsRehash is true
+// when the hash is valid but uses the legacy format or outdated parameters.
+func verifyPassword(password string, encoded string) (ok bool, needsRehash bool) {
+	if legacyHashRegex.MatchString(encoded) {
+		legacy := sha256.Sum256([]byte(password))
+		ok = subtle.ConstantTimeCompare([]byte(hex.EncodeToString(legacy[:])), []byte(encoded)) == 1
+		return ok, ok
+	}
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return false, false
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, false
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return false, false
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, time, memory, threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false
+	}
+
+	needsRehash = memory != argonMemory || time != argonTime || threads != argonThreads || len(key) != int(argonKeyLen)
+	return true, needsRehash
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	Store "ninetynine/store"
+)
+
+const passwordResetTTL = time.Hour
+
+// RequestPasswordReset mails a reset link if an account with that email
+// exists. Unknown emails are ignored so the endpoint cannot be used to probe
+// which addresses are registered.
+func RequestPasswordReset(email string) error {
+	user, err := Store.DB.GetUserByEmail(email)
+	if errors.Is(err, Store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return sendTokenEmail(user, user.Email, "password_reset", "", passwordResetTTL,
+		"/password/reset", "Reset your password",
+		"Someone asked to reset the password of your ninetynine account. "+
+			"Open the link below within an hour to choose a new one. "+
+			"If it wasn't you, you can ignore this email.")
+}
+
+// ResetPassword sets a new password using a reset token and signs the
+// account out everywhere. It returns false if the token is not valid.
+func ResetPassword(token string, newPassword string) (bool, error) {
+	resetToken, ok, err := consumeToken(token, "password_reset")
+	if err != nil || !ok {
+		return false, err
+	}
+
+	user, err := Store.DB.GetUser(resetToken.UserId)
+	if errors.Is(err, Store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	user.Password = hashPassword(newPassword)
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return false, err
+	}
+
+	return true, revokeUserSessions(user.UserId)
+}
@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	Store "ninetynine/store"
+)
+
+const (
+	RolePlayer    = "player"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// roleRank orders the roles, every role can do what the ones below it can
+var roleRank = map[string]int{
+	RolePlayer:    0,
+	RoleModerator: 1,
+	RoleAdmin:     2,
+}
+
+var (
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrAccountDisabled = errors.New("account is disabled")
+	ErrOwnAccount      = errors.New("admins cannot change their own role or disable themselves")
+	ErrNoEmail         = errors.New("user has no email address")
+)
+
+func IsValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// UserRole returns the role of a user, users stored before roles existed are players
+func UserRole(user Store.User) string {
+	if user.Role == "" {
+		return RolePlayer
+	}
+	return user.Role
+}
+
+// HasRole reports whether the user has role or one above it
+func HasRole(user Store.User, role string) bool {
+	return roleRank[UserRole(user)] >= roleRank[role]
+}
+
+// SetRole changes the role of a user on behalf of an admin
+func SetRole(adminId string, userId string, role string) (Store.User, error) {
+	if !IsValidRole(role) {
+		return Store.User{}, ErrInvalidRole
+	}
+	if adminId == userId {
+		return Store.User{}, ErrOwnAccount
+	}
+
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	user.Role = role
+	return user, Store.DB.UpdateUser(user)
+}
+
+// SetDisabled disables or re-enables an account on behalf of an admin. A
+// disabled account is signed out everywhere and cannot start new sessions.
+func SetDisabled(adminId string, userId string, disabled bool) (Store.User, error) {
+	if adminId == userId {
+		return Store.User{}, ErrOwnAccount
+	}
+
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	user.Disabled = disabled
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	if disabled {
+		return user, revokeUserSessions(userId)
+	}
+	return user, nil
+}
+
+// AdminResetPassword signs the user out everywhere and mails a reset link,
+// the admin never learns or chooses the new password
+func AdminResetPassword(userId string) error {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return err
+	}
+	if user.Email == "" {
+		return ErrNoEmail
+	}
+
+	err = revokeUserSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	return sendTokenEmail(user, user.Email, "password_reset", "", passwordResetTTL,
+		"/password/reset", "Reset your password",
+		"An administrator signed your ninetynine account out and asked you to choose a new password. "+
+			"Open the link below within an hour to set it.")
+}
+
+// FindUser looks a user up by id, email or username, whichever is given first
+func FindUser(userId string, email string, username string) (Store.User, error) {
+	switch {
+	case userId != "":
+		return Store.DB.GetUser(userId)
+	case email != "":
+		return Store.DB.GetUserByEmail(email)
+	case username != "":
+		return Store.DB.GetUserByUsername(username)
+	}
+	return Store.User{}, Store.ErrNotFound
+}
+
+// PromoteAdmins gives the admin role to the accounts with these comma
+// separated emails, so a fresh deployment has someone to hand out roles
+func PromoteAdmins(emails string) error {
+	for _, email := range strings.Split(emails, ",") {
+		email = strings.TrimSpace(email)
+		if email == "" {
+			continue
+		}
+
+		user, err := Store.DB.GetUserByEmail(email)
+		if errors.Is(err, Store.ErrNotFound) {
+			fmt.Println("No account to promote for", email)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if UserRole(user) != RoleAdmin {
+			user.Role = RoleAdmin
+			err = Store.DB.UpdateUser(user)
+			if err != nil {
+				return err
+			}
+			fmt.Println("Promoted", email, "to admin")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	Store "ninetynine/store"
+)
+
+// lastSeenAt is written at most this often per session
+const sessionTouchInterval = time.Minute
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Device describes the client that signs in or refreshes a session
+type Device struct {
+	IP        string
+	UserAgent string
+}
+
+// ActiveSession is a session as listed to its user
+type ActiveSession struct {
+	Store.Session
+	Current bool `json:"current"` // the session making the request
+}
+
+var revokeListeners []func(userId string, sessionIds []string)
+
+// OnSessionsRevoked registers a function called after sessions are revoked.
+// A nil sessionIds means every session of the user.
+func OnSessionsRevoked(listener func(userId string, sessionIds []string)) {
+	revokeListeners = append(revokeListeners, listener)
+}
+
+func sessionsRevoked(userId string, sessionIds []string) {
+	for _, listener := range revokeListeners {
+		listener(userId, sessionIds)
+	}
+}
+
+// revokeUserSessions signs the user out everywhere
+func revokeUserSessions(userId string) error {
+	err := Store.DB.RevokeUserSessions(userId)
+	if err != nil {
+		return err
+	}
+
+	sessionsRevoked(userId, nil)
+	return nil
+}
+
+// ListSessions returns the user's sessions that are neither revoked nor
+// expired, newest first
+func ListSessions(userId string, currentSessionId string) ([]ActiveSession, error) {
+	sessions, err := Store.DB.GetSessionsByUser(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	active := []ActiveSession{}
+	for _, session := range sessions {
+		if session.Revoked || session.ExpiresAt < now {
+			continue
+		}
+		active = append(active, ActiveSession{Session: session, Current: session.SessionId == currentSessionId})
+	}
+	return active, nil
+}
+
+// RevokeUserSession revokes one of the user's own sessions
+func RevokeUserSession(userId string, sessionId string) error {
+	session, err := activeSession(sessionId)
+	if errors.Is(err, ErrInvalidToken) {
+		return ErrSessionNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if session.UserId != userId {
+		return ErrSessionNotFound
+	}
+
+	return revokeSession(session)
+}
+
+// RevokeOtherSessions revokes every session of the user except keepSessionId,
+// pass an empty keepSessionId to revoke them all. It returns how many were revoked.
+func RevokeOtherSessions(userId string, keepSessionId string) (int, error) {
+	if keepSessionId == "" {
+		sessions, err := ListSessions(userId, "")
+		if err != nil {
+			return 0, err
+		}
+		return len(sessions), revokeUserSessions(userId)
+	}
+
+	sessions, err := ListSessions(userId, keepSessionId)
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := []string{}
+	for _, session := range sessions {
+		if session.Current {
+			continue
+		}
+
+		session.Revoked = true
+		if err := Store.DB.UpdateSession(session.Session); err != nil {
+			return len(revoked), err
+		}
+		revoked = append(revoked, session.SessionId)
+	}
+
+	if len(revoked) > 0 {
+		sessionsRevoked(userId, revoked)
+	}
+	return len(revoked), nil
+}
+
+func revokeSession(session Store.Session) error {
+	session.Revoked = true
+	err := Store.DB.UpdateSession(session)
+	if err != nil {
+		return err
+	}
+
+	sessionsRevoked(session.UserId, []string{session.SessionId})
+	return nil
+}
+
+// touchSession records that the session was used
+func touchSession(session Store.Session, now time.Time) error {
+	if now.Sub(time.Unix(session.LastSeenAt, 0)) < sessionTouchInterval {
+		return nil
+	}
+	return Store.DB.TouchSession(session.SessionId, now.Unix())
+}
+
+// setDevice stores where the session was last signed in or refreshed from
+func setDevice(session *Store.Session, device Device, now time.Time) {
+	session.IP = device.IP
+	session.UserAgent = device.UserAgent
+	session.DeviceLabel = deviceLabel(device.UserAgent)
+	session.LastSeenAt = now.Unix()
+}
+
+var (
+	// checked in order, Edge and Opera also claim to be Chrome and Chrome claims to be Safari
+	browserNames = [][2]string{
+		{"Edg/", "Edge"}, {"OPR/", "Opera"}, {"Firefox/", "Firefox"}, {"Chrome/", "Chrome"}, {"Safari/", "Safari"},
+	}
+	// Android claims to be Linux and iOS claims to be macOS
+	systemNames = [][2]string{
+		{"Windows", "Windows"}, {"Android", "Android"}, {"iPhone", "iOS"}, {"iPad", "iPadOS"},
+		{"Mac OS X", "macOS"}, {"CrOS", "ChromeOS"}, {"Linux", "Linux"},
+	}
+)
+
+// deviceLabel turns a user agent into a short name like "Firefox on Windows".
+// Clients that are not browsers are named after their first product token.
+func deviceLabel(userAgent string) string {
+	browser := firstMatch(userAgent, browserNames)
+	system := firstMatch(userAgent, systemNames)
+
+	if browser == "" {
+		product, _, _ := strings.Cut(userAgent, " ")
+		if browser, _, _ = strings.Cut(product, "/"); browser == "Mozilla" {
+			browser = ""
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	}
+	return "Unknown device"
+}
+
+func firstMatch(userAgent string, names [][2]string) string {
+	for _, name := range names {
+		if strings.Contains(userAgent, name[0]) {
+			return name[1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	Store "ninetynine/store"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+var tokenSecret []byte
+
+type Tokens struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"` // access token lifetime in seconds
+}
+
+type Claims struct {
+	SessionId string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// SetTokenSecret sets the HMAC key used to sign access tokens. With an empty
+// secret a random one is generated, so tokens do not survive a restart.
+func SetTokenSecret(secret string) {
+	if secret == "" {
+		fmt.Println("JWT_SECRET is not set, using a random secret")
+		random := make([]byte, 32)
+		rand.Read(random)
+		tokenSecret = random
+		return
+	}
+
+	tokenSecret = []byte(secret)
+}
+
+// CreateSession starts a new login session for the user on a device and
+// returns its tokens
+func CreateSession(userId string, device Device) (Tokens, error) {
+	secret := randomToken()
+	now := time.Now()
+
+	session := Store.Session{
+		UserId:           userId,
+		RefreshTokenHash: hashToken(secret),
+		CreatedAt:        now.Unix(),
+		ExpiresAt:        now.Add(refreshTokenTTL).Unix(),
+	}
+	setDevice(&session, device, now)
+
+	session, err := Store.DB.CreateSession(session)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return issueTokens(session, secret)
+}
+
+// RefreshSession exchanges a refresh token for a new token pair. Refresh
+// tokens are single use, presenting an old one revokes the whole session.
+// Disabled accounts get ErrAccountDisabled.
+func RefreshSession(refreshToken string, device Device) (Tokens, error) {
+	sessionId, secret, found := strings.Cut(refreshToken, ".")
+	if !found {
+		return Tokens{}, ErrInvalidToken
+	}
+
+	session, err := activeSession(sessionId)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(session.RefreshTokenHash)) != 1 {
+		err = revokeSession(session)
+		if err != nil {
+			return Tokens{}, err
+		}
+		return Tokens{}, ErrInvalidToken
+	}
+
+	user, err := Store.DB.GetUser(session.UserId)
+	if errors.Is(err, Store.ErrNotFound) {
+		return Tokens{}, ErrInvalidToken
+	}
+	if err != nil {
+		return Tokens{}, err
+	}
+	if user.Disabled {
+		return Tokens{}, ErrAccountDisabled
+	}
+
+	now := time.Now()
+	secret = randomToken()
+	session.RefreshTokenHash = hashToken(secret)
+	session.ExpiresAt = now.Add(refreshTokenTTL).Unix()
+	setDevice(&session, device, now)
+
+	err = Store.DB.UpdateSession(session)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return issueTokens(session, secret)
+}
+
+// RevokeSession ends a session, its access and refresh tokens stop working
+func RevokeSession(sessionId string) error {
+	session, err := Store.DB.GetSession(sessionId)
+	if errors.Is(err, Store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return revokeSession(session)
+}
+
+// VerifyAccessToken checks the token signature and that its session is
+// still active, returning the user and session it belongs to
+func VerifyAccessToken(accessToken string) (Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(accessToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		return tokenSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return Claims{}, ErrInvalidToken
+	}
+
+	session, err := activeSession(claims.SessionId)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	if session.UserId != claims.Subject {
+		return Claims{}, ErrInvalidToken
+	}
+
+	// the session was just checked, failing to record the visit is not fatal
+	if err := touchSession(session, time.Now()); err != nil {
+		fmt.Println("Error updating session", err)
+	}
+
+	return claims, nil
+}
+
+func activeSession(sessionId string) (Store.Session, error) {
+	session, err := Store.DB.GetSession(sessionId)
+	if errors.Is(err, Store.ErrNotFound) {
+		return Store.Session{}, ErrInvalidToken
+	}
+	if err != nil {
+		return Store.Session{}, err
+	}
+
+	if session.Revoked || session.ExpiresAt < time.Now().Unix() {
+		return Store.Session{}, ErrInvalidToken
+	}
+
+	return session, nil
+}
+
+func issueTokens(session Store.Session, secret string) (Tokens, error) {
+	now := time.Now()
+	claims := Claims{
+		SessionId: session.SessionId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   session.UserId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(tokenSecret)
+	if err != nil {
+		return Tokens{}, err
+	}
+
+	return Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: session.SessionId + "." + secret,
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// hashToken is used for high entropy random tokens, passwords use hashPassword
+func hashToken(token string) string {
+	hashed := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hashed[:])
+}
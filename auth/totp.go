@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP as described in RFC 6238 with the parameters every authenticator app
+// supports: SHA-1, 6 digits and a 30 second step
+const (
+	totpIssuer = "ninetynine"
+	totpDigits = 6
+	totpPeriod = 30
+	totpSkew   = 1 // steps accepted on either side of the current one for clock drift
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func newTOTPSecret() string {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return totpEncoding.EncodeToString(secret)
+}
+
+// totpURI is the otpauth URI authenticator apps read from a QR code
+func totpURI(secret string, account string) string {
+	label := url.PathEscape(totpIssuer + ":" + account)
+	query := url.Values{
+		"secret":    {secret},
+		"issuer":    {totpIssuer},
+		"algorithm": {"SHA1"},
+		"digits":    {fmt.Sprint(totpDigits)},
+		"period":    {fmt.Sprint(totpPeriod)},
+	}
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation from RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// verifyTOTP checks a code against the steps around now. It returns the
+// matching step, which has to be later than lastStep so a code cannot be
+// used twice.
+func verifyTOTP(secret string, code string, lastStep int64, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	Store "ninetynine/store"
+	Throttle "ninetynine/throttle"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	recoveryCodeCount   = 10
+	twoFactorTokenTTL   = 5 * time.Minute
+	twoFactorAudience   = "2fa"
+	recoveryCodeLetters = "abcdefghjkmnpqrstuvwxyz123456789" // 32 without look-alikes, so a byte maps evenly
+)
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted = errors.New("two-factor setup was not started")
+	ErrInvalidCode         = errors.New("invalid two-factor code")
+)
+
+// TooManyCodesError is returned while code attempts for an account are throttled
+type TooManyCodesError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyCodesError) Error() string {
+	return "too many two-factor attempts"
+}
+
+type TwoFactorSetup struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauthUri"`
+}
+
+// BeginTwoFactorSetup generates a new secret for the user. It only protects
+// logins once ConfirmTwoFactor proves the authenticator app has it.
+func BeginTwoFactorSetup(userId string) (TwoFactorSetup, error) {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+	if user.TOTPEnabled {
+		return TwoFactorSetup{}, ErrTwoFactorEnabled
+	}
+
+	user.TOTPSecret = newTOTPSecret()
+	user.TOTPLastStep = 0
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return TwoFactorSetup{}, err
+	}
+
+	account := user.Email
+	if account == "" {
+		account = user.Username
+	}
+
+	return TwoFactorSetup{Secret: user.TOTPSecret, OtpauthURI: totpURI(user.TOTPSecret, account)}, nil
+}
+
+// ConfirmTwoFactor enables 2FA with the first code from the authenticator
+// app and returns the recovery codes, the only time they are shown
+func ConfirmTwoFactor(userId string, code string) ([]string, error) {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotStarted
+	}
+
+	err = checkCode(&user, code, false)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TOTPEnabled = true
+	codes := newRecoveryCodes(&user)
+	return codes, Store.DB.UpdateUser(user)
+}
+
+// DisableTwoFactor turns 2FA off after confirming the user and checking a code
+func DisableTwoFactor(userId string, confirmation Confirmation, code string) error {
+	user, err := ConfirmUser(userId, confirmation)
+	if err != nil {
+		return err
+	}
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	err = checkCode(&user, code, true)
+	if err != nil {
+		return err
+	}
+
+	user.TOTPEnabled = false
+	user.TOTPSecret = ""
+	user.TOTPLastStep = 0
+	user.RecoveryCodes = nil
+	return Store.DB.UpdateUser(user)
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a code
+func RegenerateRecoveryCodes(userId string, code string) ([]string, error) {
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !user.TOTPEnabled {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	err = checkCode(&user, code, true)
+	if err != nil {
+		return nil, err
+	}
+
+	codes := newRecoveryCodes(&user)
+	return codes, Store.DB.UpdateUser(user)
+}
+
+type twoFactorClaims struct {
+	jwt.RegisteredClaims
+}
+
+// CreateTwoFactorChallenge is handed out instead of a session when the
+// password of a 2FA account was correct. It is exchanged for a session
+// together with a code in VerifyTwoFactorLogin.
+func CreateTwoFactorChallenge(userId string) (string, error) {
+	now := time.Now()
+	claims := twoFactorClaims{jwt.RegisteredClaims{
+		Subject:   userId,
+		Audience:  jwt.ClaimStrings{twoFactorAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(twoFactorTokenTTL)),
+	}}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(tokenSecret)
+}
+
+// VerifyTwoFactorLogin checks the second login step, code is either a TOTP
+// code or an unused recovery code
+func VerifyTwoFactorLogin(challenge string, code string) (Store.User, error) {
+	var claims twoFactorClaims
+	_, err := jwt.ParseWithClaims(challenge, &claims, func(token *jwt.Token) (interface{}, error) {
+		return tokenSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(twoFactorAudience))
+	if err != nil {
+		return Store.User{}, ErrInvalidToken
+	}
+
+	user, err := Store.DB.GetUser(claims.Subject)
+	if errors.Is(err, Store.ErrNotFound) {
+		return Store.User{}, ErrInvalidToken
+	}
+	if err != nil {
+		return Store.User{}, err
+	}
+	if !user.TOTPEnabled {
+		return Store.User{}, ErrTwoFactorNotEnabled
+	}
+
+	err = checkCode(&user, code, true)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	return user, Store.DB.UpdateUser(user)
+}
+
+// checkCode verifies a code for user under the 2FA throttle and records what
+// it used up, the caller saves the user
+func checkCode(user *Store.User, code string, allowRecovery bool) error {
+	wait, err := Throttle.CheckTwoFactor(user.UserId)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return &TooManyCodesError{RetryAfter: wait}
+	}
+
+	if step, ok := verifyTOTP(user.TOTPSecret, code, user.TOTPLastStep, time.Now()); ok {
+		user.TOTPLastStep = step
+		return Throttle.TwoFactorSucceeded(user.UserId)
+	}
+
+	if allowRecovery && useRecoveryCode(user, code) {
+		return Throttle.TwoFactorSucceeded(user.UserId)
+	}
+
+	err = Throttle.TwoFactorFailed(user.UserId)
+	if err != nil {
+		return err
+	}
+	return ErrInvalidCode
+}
+
+// newRecoveryCodes replaces the user's recovery codes, only hashes are kept
+func newRecoveryCodes(user *Store.User) []string {
+	codes := []string{}
+	hashes := Store.StringList{}
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		rand.Read(raw)
+
+		var builder strings.Builder
+		for j, b := range raw {
+			if j == 5 {
+				builder.WriteByte('-')
+			}
+			builder.WriteByte(recoveryCodeLetters[b%32])
+		}
+
+		codes = append(codes, builder.String())
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(builder.String())))
+	}
+
+	user.RecoveryCodes = hashes
+	return codes
+}
+
+// useRecoveryCode removes a matching recovery code, each works once
+func useRecoveryCode(user *Store.User, code string) bool {
+	hashed := hashToken(normalizeRecoveryCode(code))
+
+	remaining := Store.StringList{}
+	found := false
+	for _, stored := range user.RecoveryCodes {
+		if stored == hashed && !found {
+			found = true
+			continue
+		}
+		remaining = append(remaining, stored)
+	}
+
+	if found {
+		user.RecoveryCodes = remaining
+	}
+	return found
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	Store "ninetynine/store"
+	Throttle "ninetynine/throttle"
+)
+
+const unlockTTL = time.Hour
+
+// SendUnlockEmail tells the owner their account was locked after too many
+// failed logins and mails a link that lifts the lockout
+func SendUnlockEmail(email string) error {
+	user, err := Store.DB.GetUserByEmail(email)
+	if errors.Is(err, Store.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	return sendTokenEmail(user, user.Email, "unlock_account", "", unlockTTL,
+		"/account/unlock", "Your account was locked",
+		"We locked your ninetynine account for a while after too many failed login attempts. "+
+			"If it was you, open the link below to unlock it right away. "+
+			"If it wasn't, consider resetting your password.")
+}
+
+// UnlockAccount lifts a login lockout using an unlock token. It returns
+// false if the token is not valid.
+func UnlockAccount(token string) (bool, error) {
+	unlockToken, ok, err := consumeToken(token, "unlock_account")
+	if err != nil || !ok {
+		return false, err
+	}
+
+	user, err := Store.DB.GetUser(unlockToken.UserId)
+	if errors.Is(err, Store.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, Throttle.Unlock(user.Email)
+}
@@ -0,0 +1,274 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// UsernamePolicy decides which usernames are accepted. Length is counted in
+// characters. Reserved names and blocked words are compared on the
+// confusable skeleton of a name, so "Adm1n", "a.d.m.i.n" and a Cyrillic
+// "аdmin" are all caught as "admin".
+type UsernamePolicy struct {
+	MinLength      int
+	MaxLength      int
+	AllowedSymbols string   // allowed besides letters and digits, never first or last
+	Reserved       []string // matched against the whole name without trailing digits
+	BlockedWords   []string // matched anywhere in the name
+}
+
+var UsernameRules = UsernamePolicy{
+	MinLength:      3,
+	MaxLength:      20,
+	AllowedSymbols: "_.-",
+	Reserved: []string{
+		"admin", "administrator", "moderator", "mod", "staff", "support", "system",
+		"server", "root", "official", "ninetynine", "guest", "player", "deleted",
+	},
+	BlockedWords: []string{
+		"fuck", "shit", "cunt", "bitch", "whore", "slut", "nazi", "hitler",
+	},
+}
+
+// username error codes, returned to clients next to the message
+const (
+	UsernameTooShort          = "username_too_short"
+	UsernameTooLong           = "username_too_long"
+	UsernameInvalidCharacters = "username_invalid_characters"
+	UsernameMixedScripts      = "username_mixed_scripts"
+	UsernameReserved          = "username_reserved"
+	UsernameInappropriate     = "username_inappropriate"
+	UsernameTaken             = "username_taken"
+)
+
+type UsernameError struct {
+	Code    string
+	Message string
+}
+
+func (e *UsernameError) Error() string {
+	return e.Message
+}
+
+// LoadUsernamePolicy overrides the default rules from USERNAME_MIN_LENGTH,
+// USERNAME_MAX_LENGTH, USERNAME_ALLOWED_SYMBOLS, USERNAME_RESERVED (comma
+// separated, added to the defaults) and USERNAME_BLOCKLIST_FILE (one word
+// per line, replaces the defaults)
+func LoadUsernamePolicy() error {
+	for env, target := range map[string]*int{
+		"USERNAME_MIN_LENGTH": &UsernameRules.MinLength,
+		"USERNAME_MAX_LENGTH": &UsernameRules.MaxLength,
+	} {
+		if value := os.Getenv(env); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				return fmt.Errorf("invalid %s %q", env, value)
+			}
+			*target = parsed
+		}
+	}
+	if UsernameRules.MinLength > UsernameRules.MaxLength {
+		return fmt.Errorf("USERNAME_MIN_LENGTH is larger than USERNAME_MAX_LENGTH")
+	}
+
+	if symbols, ok := os.LookupEnv("USERNAME_ALLOWED_SYMBOLS"); ok {
+		UsernameRules.AllowedSymbols = symbols
+	}
+
+	for _, name := range strings.Split(os.Getenv("USERNAME_RESERVED"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			UsernameRules.Reserved = append(UsernameRules.Reserved, name)
+		}
+	}
+
+	if path := os.Getenv("USERNAME_BLOCKLIST_FILE"); path != "" {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		words := []string{}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			word := strings.TrimSpace(scanner.Text())
+			if word != "" && !strings.HasPrefix(word, "#") {
+				words = append(words, word)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		UsernameRules.BlockedWords = words
+	}
+
+	return nil
+}
+
+// CheckUsername normalizes a username chosen by a user and checks it against
+// UsernameRules. The normalized name is the one to store.
+func CheckUsername(username string) (string, error) {
+	return UsernameRules.check(username, false)
+}
+
+// check skips the reserved list for names the server generates itself, like
+// the "Guest" names
+func (p UsernamePolicy) check(username string, generated bool) (string, error) {
+	username = norm.NFKC.String(strings.TrimSpace(username))
+
+	length := utf8.RuneCountInString(username)
+	if length < p.MinLength {
+		return "", &UsernameError{UsernameTooShort,
+			fmt.Sprintf("Username must be at least %d characters", p.MinLength)}
+	}
+	if length > p.MaxLength {
+		return "", &UsernameError{UsernameTooLong,
+			fmt.Sprintf("Username must be at most %d characters", p.MaxLength)}
+	}
+
+	for i, r := range username {
+		isSymbol := strings.ContainsRune(p.AllowedSymbols, r)
+		isEdge := i == 0 || i+utf8.RuneLen(r) == len(username)
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && (!isSymbol || isEdge) {
+			return "", &UsernameError{UsernameInvalidCharacters, p.charactersMessage()}
+		}
+	}
+
+	if mixesScripts(username) {
+		return "", &UsernameError{UsernameMixedScripts,
+			"Username cannot mix letters from different alphabets"}
+	}
+
+	skeleton := usernameSkeleton(username)
+	if !generated {
+		base := usernameSkeleton(strings.TrimRightFunc(username, unicode.IsDigit))
+		for _, reserved := range p.Reserved {
+			if base == usernameSkeleton(reserved) {
+				return "", &UsernameError{UsernameReserved, "This username is reserved"}
+			}
+		}
+	}
+
+	for _, word := range p.BlockedWords {
+		if word := usernameSkeleton(word); word != "" && strings.Contains(skeleton, word) {
+			return "", &UsernameError{UsernameInappropriate, "This username is not allowed"}
+		}
+	}
+
+	return username, nil
+}
+
+func (p UsernamePolicy) charactersMessage() string {
+	if p.AllowedSymbols == "" {
+		return "Username can only contain letters and digits"
+	}
+	symbols := strings.Join(strings.Split(p.AllowedSymbols, ""), " ")
+	return "Username can only contain letters, digits and " + symbols + ", and must start and end with a letter or digit"
+}
+
+// sanitize turns free text like a display name into something that
+// passes the character and length rules, or "" if nothing usable is left.
+// room is kept at the end for the digits availableUsername may append.
+func (p UsernamePolicy) sanitize(text string, room int) string {
+	var builder strings.Builder
+	for _, r := range norm.NFKC.String(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(p.AllowedSymbols, r) {
+			builder.WriteRune(r)
+		}
+	}
+
+	runes := []rune(strings.Trim(builder.String(), p.AllowedSymbols))
+	if limit := p.MaxLength - room; len(runes) > limit && limit > 0 {
+		runes = []rune(strings.Trim(string(runes[:limit]), p.AllowedSymbols))
+	}
+
+	name := string(runes)
+	if _, err := p.check(name, false); err != nil {
+		return ""
+	}
+	return name
+}
+
+// scriptGroups are the alphabets a username may use, one per name. Scripts
+// that are normally written together share a group.
+var scriptGroups = [][]*unicode.RangeTable{
+	{unicode.Latin},
+	{unicode.Cyrillic},
+	{unicode.Greek},
+	{unicode.Armenian},
+	{unicode.Georgian},
+	{unicode.Arabic},
+	{unicode.Hebrew},
+	{unicode.Thai},
+	{unicode.Devanagari},
+	{unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul, unicode.Bopomofo},
+}
+
+func mixesScripts(username string) bool {
+	group := -1
+	for _, r := range username {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		current := len(scriptGroups) // any other script
+		for i, tables := range scriptGroups {
+			if unicode.IsOneOf(tables, r) {
+				current = i
+				break
+			}
+		}
+
+		if group != -1 && group != current {
+			return true
+		}
+		group = current
+	}
+	return false
+}
+
+// confusables maps characters that look alike to one representative, after
+// accents are removed and case is folded. Digits and symbols cover the usual
+// letter substitutions.
+var confusables = map[rune]rune{
+	// cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'і': 'l', 'ї': 'l', 'ј': 'j', 'һ': 'h',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ь': 'b',
+	// greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w', 'μ': 'u',
+	// latin look-alikes, i and l are folded together like 1 and |
+	'i': 'l', 'ı': 'l', 'ł': 'l',
+	// digits and symbols
+	'0': 'o', '1': 'l', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+	'@': 'a', '$': 's', '!': 'l', '|': 'l',
+}
+
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// usernameSkeleton reduces a name to the form used for reserved and blocked
+// word comparisons. It is never stored or shown.
+func usernameSkeleton(name string) string {
+	var builder strings.Builder
+	for _, r := range cases.Fold().String(norm.NFKD.String(name)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if mapped, ok := confusables[r]; ok {
+			r = mapped
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			builder.WriteRune(r)
+		}
+	}
+	return confusableSequences.Replace(builder.String())
+}
@@ -0,0 +1,155 @@
+package avatar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"net/url"
+	"strings"
+
+	Store "ninetynine/store"
+)
+
+const (
+	gridSize    = 5 // cells per side, the left half is mirrored to the right
+	DefaultSize = 256
+	MaxSize     = 1024
+)
+
+var background = color.RGBA{0xf0, 0xf0, 0xf0, 0xff}
+
+var serverURL string
+
+// SetServerURL sets the public address of this server, generated avatar
+// URLs are relative to the current host when it is empty
+func SetServerURL(url string) {
+	serverURL = strings.TrimSuffix(url, "/")
+}
+
+// DefaultURL is the generated avatar of a user without a profile picture
+func DefaultURL(userId string) string {
+	return serverURL + "/avatar/" + url.PathEscape(userId) + ".png"
+}
+
+// URL is the picture to show for a user, the upload if there is one and the
+// generated avatar otherwise
+func URL(user Store.User) string {
+	if user.ProfilePic != "" {
+		return user.ProfilePic
+	}
+	return DefaultURL(user.UserId)
+}
+
+type identicon struct {
+	cells [gridSize][gridSize]bool
+	color color.RGBA
+}
+
+// newIdenticon derives the pattern and color from the sha256 of the userId,
+// so the same user always gets the same picture
+func newIdenticon(userId string) identicon {
+	sum := sha256.Sum256([]byte(userId))
+
+	var icon identicon
+	bit := 0
+	for y := 0; y < gridSize; y++ {
+		for x := 0; x < (gridSize+1)/2; x++ {
+			on := sum[bit/8]&(1<<(bit%8)) != 0
+			icon.cells[y][x] = on
+			icon.cells[y][gridSize-1-x] = on
+			bit++
+		}
+	}
+
+	hue := float64(uint16(sum[30])<<8|uint16(sum[31])) / 65536 * 360
+	icon.color = hslToRGB(hue, 0.55, 0.55)
+	return icon
+}
+
+// IdenticonPNG renders the avatar of userId as a square png, with half a
+// cell of padding around the grid
+func IdenticonPNG(userId string, size int) ([]byte, error) {
+	icon := newIdenticon(userId)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for py := 0; py < size; py++ {
+		for px := 0; px < size; px++ {
+			x, inX := cell(px, size)
+			y, inY := cell(py, size)
+			if inX && inY && icon.cells[y][x] {
+				img.SetRGBA(px, py, icon.color)
+			} else {
+				img.SetRGBA(px, py, background)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// cell maps a pixel to its grid cell, the grid spans gridSize+1 cells of
+// which the outer half cell on each side is padding
+func cell(pixel int, size int) (int, bool) {
+	pos := (float64(pixel)+0.5)*float64(gridSize+1)/float64(size) - 0.5
+	if pos < 0 || pos >= gridSize {
+		return 0, false
+	}
+	return int(pos), true
+}
+
+// IdenticonSVG renders the same avatar as IdenticonPNG as a scalable svg
+func IdenticonSVG(userId string) []byte {
+	icon := newIdenticon(userId)
+
+	// a grid of 2 units per cell leaves 1 unit of padding on each side
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		gridSize*2+2, gridSize*2+2)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, hex(background))
+	for y := 0; y < gridSize; y++ {
+		for x := 0; x < gridSize; x++ {
+			if icon.cells[y][x] {
+				fmt.Fprintf(&buf, `<rect x="%d" y="%d" width="2" height="2" fill="%s"/>`, x*2+1, y*2+1, hex(icon.color))
+			}
+		}
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes()
+}
+
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+func hslToRGB(h float64, s float64, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 0xff}
+}
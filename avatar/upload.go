@@ -0,0 +1,108 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // registers the decoder used by image.Decode
+	"image/png"
+
+	Blob "ninetynine/blob"
+	Store "ninetynine/store"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the decoder used by image.Decode
+)
+
+const (
+	MaxUploadSize = 5 << 20 // bytes
+	MinDimension  = 64      // pixels, on the shorter side
+	MaxDimension  = 4096    // pixels, on either side
+)
+
+// Sizes are the square thumbnails stored for every upload, the last one is
+// the profile picture everybody else sees
+var Sizes = []int{64, 256}
+
+var (
+	ErrTooLarge          = errors.New("image is too large")
+	ErrUnsupportedFormat = errors.New("image must be png, jpeg or webp")
+	ErrBadDimensions     = errors.New("image dimensions out of range")
+)
+
+// Upload validates an uploaded image, stores it as square png thumbnails and
+// points the user's profile picture at the largest one
+func Upload(userId string, data []byte) (Store.User, error) {
+	if len(data) > MaxUploadSize {
+		return Store.User{}, ErrTooLarge
+	}
+
+	// check the header before decoding so huge images are never allocated
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "png" && format != "jpeg" && format != "webp") {
+		return Store.User{}, ErrUnsupportedFormat
+	}
+	if min(config.Width, config.Height) < MinDimension || max(config.Width, config.Height) > MaxDimension {
+		return Store.User{}, ErrBadDimensions
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Store.User{}, ErrUnsupportedFormat
+	}
+
+	user, err := Store.DB.GetUser(userId)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	var url string
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		err = png.Encode(&buf, thumbnail(src, size))
+		if err != nil {
+			return Store.User{}, err
+		}
+
+		url, err = Blob.Client.Put(key(userId, size), "image/png", buf.Bytes())
+		if err != nil {
+			return Store.User{}, err
+		}
+	}
+
+	user.ProfilePic = url
+	err = Store.DB.UpdateUser(user)
+	if err != nil {
+		return Store.User{}, err
+	}
+
+	return user, nil
+}
+
+// Delete removes the stored thumbnails of a user
+func Delete(userId string) error {
+	for _, size := range Sizes {
+		err := Blob.Client.Delete(key(userId, size))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// thumbnail crops the center square of src and scales it to size
+func thumbnail(src image.Image, size int) *image.RGBA {
+	bounds := src.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x := bounds.Min.X + (bounds.Dx()-side)/2
+	y := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, image.Rect(x, y, x+side, y+side), draw.Src, nil)
+	return dst
+}
+
+func key(userId string, size int) string {
+	return fmt.Sprintf("avatars/%s/%d.png", userId, size)
+}
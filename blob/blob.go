@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	Firebase "ninetynine/firebase"
+)
+
+// Storage keeps uploaded files under a key and hands out a public URL for
+// them. The URL changes whenever the content under a key is replaced so
+// clients never keep showing a cached copy.
+type Storage interface {
+	Put(key string, contentType string, data []byte) (string, error)
+	Delete(key string) error
+}
+
+var Client Storage
+
+// Initialize selects where uploads are kept. "local" (the default) writes
+// them to BLOB_DIR and serves them under BLOB_URL, "firebase" uploads them
+// to FIREBASE_STORAGE_BUCKET.
+func Initialize(backend string) error {
+	if backend == "" {
+		backend = "local"
+	}
+
+	switch backend {
+	case "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		baseURL := os.Getenv("BLOB_URL")
+		if baseURL == "" {
+			baseURL = strings.TrimSuffix(os.Getenv("SERVER_URL"), "/") + LocalPath
+		}
+		Client = NewLocalStorage(dir, baseURL)
+	case "firebase":
+		bucketName := os.Getenv("FIREBASE_STORAGE_BUCKET")
+		if bucketName == "" {
+			return errors.New("FIREBASE_STORAGE_BUCKET is not set")
+		}
+		Firebase.InitializeFirebase()
+		bucket, err := Firebase.StorageClient.Bucket(bucketName)
+		if err != nil {
+			return err
+		}
+		Client = NewFirebaseStorage(bucket, bucketName)
+	default:
+		return fmt.Errorf("unknown blob storage %q", backend)
+	}
+
+	fmt.Println("Using", backend, "blob storage")
+	return nil
+}
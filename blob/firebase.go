@@ -0,0 +1,61 @@
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"cloud.google.com/go/storage"
+)
+
+// FirebaseStorage uploads files to a Cloud Storage bucket and returns
+// Firebase download URLs, so the bucket itself can stay private
+type FirebaseStorage struct {
+	bucket     *storage.BucketHandle
+	bucketName string
+}
+
+func NewFirebaseStorage(bucket *storage.BucketHandle, bucketName string) *FirebaseStorage {
+	return &FirebaseStorage{bucket: bucket, bucketName: bucketName}
+}
+
+func (s *FirebaseStorage) Put(key string, contentType string, data []byte) (string, error) {
+	ctx := context.Background()
+
+	// a new download token on every upload also busts client caches
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	downloadToken := hex.EncodeToString(raw)
+
+	writer := s.bucket.Object(key).NewWriter(ctx)
+	writer.ContentType = contentType
+	writer.CacheControl = "public, max-age=86400"
+	writer.Metadata = map[string]string{"firebaseStorageDownloadTokens": downloadToken}
+
+	_, err = writer.Write(data)
+	if err != nil {
+		writer.Close()
+		return "", err
+	}
+	err = writer.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("https://firebasestorage.googleapis.com/v0/b/%s/o/%s?alt=media&token=%s",
+		s.bucketName, url.PathEscape(key), downloadToken), nil
+}
+
+func (s *FirebaseStorage) Delete(key string) error {
+	err := s.bucket.Object(key).Delete(context.Background())
+	if errors.Is(err, storage.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package blob
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LocalPath is where the server mounts FileServer for local storage
+const LocalPath = "/uploads/"
+
+// LocalStorage writes files below a directory on disk
+type LocalStorage struct {
+	dir     string
+	baseURL string
+}
+
+func NewLocalStorage(dir string, baseURL string) *LocalStorage {
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return &LocalStorage{dir: dir, baseURL: baseURL}
+}
+
+func (s *LocalStorage) Put(key string, contentType string, data []byte) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	// write next to the target and rename so readers never see half a file
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	err = os.Rename(tmp, path)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%s?v=%d", s.baseURL, key, time.Now().UnixNano()), nil
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// FileServer serves the stored files, mount it under LocalPath
+func (s *LocalStorage) FileServer() http.Handler {
+	return http.StripPrefix(LocalPath, http.FileServer(http.Dir(s.dir)))
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	clean := filepath.Clean("/" + key)
+	if clean == "/" || clean != "/"+key {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
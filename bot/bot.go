@@ -0,0 +1,175 @@
+// Package bot chooses plays for players the server plays for. Strategies only
+// use what a player at the table knows: their own hand, the stack, the rules,
+// how many cards the others hold and which cards have not been seen.
+package bot
+
+import (
+	Engine "ninetynine/engine"
+)
+
+// Strategy picks one of the legal plays of a player, ok is false when the
+// player has none
+type Strategy func(state Engine.State, playerId string, rng *Engine.RNG) (play Engine.PlayCard, ok bool)
+
+// Strategies by the name the lobby uses
+var Strategies = map[string]Strategy{
+	"random":    Random,
+	"greedy":    Greedy,
+	"lookahead": Lookahead,
+}
+
+// DefaultStrategy plays for humans that disconnected
+const DefaultStrategy = "greedy"
+
+// Random plays any legal card
+func Random(state Engine.State, playerId string, rng *Engine.RNG) (Engine.PlayCard, bool) {
+	plays := Engine.LegalPlays(state, playerId)
+	if len(plays) == 0 {
+		return Engine.PlayCard{}, false
+	}
+	return plays[rng.Intn(len(plays))], true
+}
+
+// Greedy gets rid of its highest number card that fits and only plays a
+// special when it has to, the one leaving the stack lowest
+func Greedy(state Engine.State, playerId string, rng *Engine.RNG) (Engine.PlayCard, bool) {
+	return best(state, playerId, func(play Engine.PlayCard) float64 {
+		if !play.Card.IsSpecial {
+			return float64(play.Card.Value)
+		}
+		return -100 - float64(Engine.StackAfter(state, play))
+	})
+}
+
+// Lookahead counts cards. It prefers the play most likely to leave the next
+// player without a card that fits, keeps specials for when it is stuck and
+// avoids keeping a hand it could not play from once the stack comes back
+// around, above all one that does not even fit the stack it leaves.
+func Lookahead(state Engine.State, playerId string, rng *Engine.RNG) (Engine.PlayCard, bool) {
+	unseen := Engine.Unseen(state, playerId)
+	hand := state.Players[state.PlayerIndex(playerId)].Cards
+	opponents := 0
+	for _, p := range state.Players {
+		if !p.IsOut && p.PlayerId != playerId {
+			opponents++
+		}
+	}
+
+	return best(state, playerId, func(play Engine.PlayCard) float64 {
+		stack := Engine.StackAfter(state, play)
+		next := state.Players[nextPlayer(state, play)]
+		score := stuckChance(state.Rules, stack, len(next.Cards), unseen)
+
+		if play.Card.IsSpecial {
+			score -= 0.25
+		} else {
+			score += 0.01 * float64(play.Card.Value)
+		}
+
+		// a number card adds about 5 on average, see if a card would be left
+		// to play after every opponent had a turn
+		keep := without(hand, play.Card)
+		switch {
+		case !playable(state.Rules, stack, keep):
+			return score - 1
+		case !playable(state.Rules, stack+5*opponents, keep):
+			return score - 0.3
+		}
+		return score
+	})
+}
+
+// best returns the legal play with the highest score, the first on ties
+func best(state Engine.State, playerId string, score func(Engine.PlayCard) float64) (Engine.PlayCard, bool) {
+	plays := Engine.LegalPlays(state, playerId)
+	if len(plays) == 0 {
+		return Engine.PlayCard{}, false
+	}
+
+	chosen, chosenScore := plays[0], score(plays[0])
+	for _, play := range plays[1:] {
+		if s := score(play); s > chosenScore {
+			chosen, chosenScore = play, s
+		}
+	}
+	return chosen, true
+}
+
+// stuckChance is the chance that a hand of size cards drawn from unseen has
+// nothing that can be played on stack
+func stuckChance(rules Engine.Rules, stack int, size int, unseen []Engine.Card) float64 {
+	if len(unseen) == 0 || size == 0 {
+		return 0
+	}
+
+	stuck := 0
+	for _, card := range unseen {
+		if !card.IsSpecial && !fits(rules, stack, card.Value) {
+			stuck++
+		}
+	}
+
+	chance := 1.0
+	for i := 0; i < size; i++ {
+		chance *= float64(stuck) / float64(len(unseen))
+	}
+	return chance
+}
+
+// fits reports whether a number card can be played on stack
+func fits(rules Engine.Rules, stack int, value int) bool {
+	if stack+value == rules.TargetValue {
+		return rules.AtLimit != Engine.AtLimitForbidden
+	}
+	return stack+value < rules.TargetValue
+}
+
+// nextPlayer guesses who plays after play, a shuffle card makes it a guess
+func nextPlayer(state Engine.State, play Engine.PlayCard) int {
+	if play.Card == Engine.TargetCard {
+		return state.PlayerIndex(play.TargetId)
+	}
+
+	direction := state.CurrentDirection
+	if play.Card == (Engine.Card{Value: Engine.SpecialReverse, IsSpecial: true}) {
+		direction = -direction
+	}
+
+	next := step(state, state.CurrentPlayerIndex, direction)
+	if play.Card == Engine.SkipCard {
+		next = step(state, next, direction)
+	}
+	return next
+}
+
+// step returns the next seat in direction whose player is still in
+func step(state Engine.State, from int, direction int) int {
+	i := from
+	for range state.Players {
+		i = (i + direction + len(state.Players)) % len(state.Players)
+		if !state.Players[i].IsOut {
+			return i
+		}
+	}
+	return from
+}
+
+// playable reports whether one of cards can be played on stack
+func playable(rules Engine.Rules, stack int, cards []Engine.Card) bool {
+	for _, card := range cards {
+		if card.IsSpecial || fits(rules, stack, card.Value) {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns cards with one copy of card taken out
+func without(cards []Engine.Card, card Engine.Card) []Engine.Card {
+	for i, c := range cards {
+		if c == card {
+			return append(append([]Engine.Card{}, cards[:i]...), cards[i+1:]...)
+		}
+	}
+	return cards
+}
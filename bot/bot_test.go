@@ -0,0 +1,140 @@
+package bot
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	Engine "ninetynine/engine"
+)
+
+func number(value int) Engine.Card {
+	return Engine.Card{Value: value}
+}
+
+// allSpecials are the classic rules with every special card in play
+func allSpecials() Engine.Rules {
+	rules := Engine.ClassicRules
+	rules.Specials = append(append([]int{}, rules.Specials...), Engine.SpecialChoose, Engine.SpecialSkip, Engine.SpecialTarget)
+	return rules
+}
+
+// running returns a game in its first round where the first player has the
+// turn, like the one the engine tests use
+func running(stack int, hands ...[]Engine.Card) Engine.State {
+	state := Engine.NewState(Engine.NewRNG(1))
+	state.Rules = allSpecials()
+	state.Status = Engine.StatusPlaying
+	state.Round = 1
+	state.StackValue = stack
+	state.DrawPile = []Engine.Card{number(1), number(1), number(1), number(1)}
+	for i, hand := range hands {
+		state.Players = append(state.Players, Engine.Player{
+			PlayerId:   fmt.Sprintf("p%d", i+1),
+			PlayerName: fmt.Sprintf("Player %d", i+1),
+			Status:     Engine.PlayerPlaying,
+			Cards:      hand,
+		})
+	}
+	return state
+}
+
+func TestStrategiesPlayLegally(t *testing.T) {
+	for name, strategy := range Strategies {
+		t.Run(name, func(t *testing.T) {
+			for seed := uint64(1); seed <= 20; seed++ {
+				state := Engine.NewState(Engine.NewRNG(seed))
+				state = apply(t, state, Engine.SetRules{Rules: allSpecials()})
+				for i := 1; i <= 3; i++ {
+					state = apply(t, state, Engine.Join{PlayerId: fmt.Sprintf("p%d", i)})
+				}
+				state = apply(t, state, Engine.Start{})
+
+				rng := Engine.NewRNG(seed)
+				for turn := 0; state.Status == Engine.StatusPlaying; turn++ {
+					if turn > 1000 {
+						t.Fatalf("seed %d: the game did not end", seed)
+					}
+
+					playerId := state.Players[state.CurrentPlayerIndex].PlayerId
+					play, ok := strategy(state, playerId, &rng)
+					if !ok {
+						t.Fatalf("seed %d: no play for %s holding %v on %d", seed, playerId, state.Players[state.CurrentPlayerIndex].Cards, state.StackValue)
+					}
+					if !contains(Engine.LegalPlays(state, playerId), play) {
+						t.Fatalf("seed %d: %+v is not a legal play on %d", seed, play, state.StackValue)
+					}
+					state = apply(t, state, play)
+				}
+			}
+		})
+	}
+}
+
+func TestStrategiesWithoutAPlay(t *testing.T) {
+	state := running(95, []Engine.Card{number(5), number(9)}, []Engine.Card{number(1)})
+	for name, strategy := range Strategies {
+		rng := Engine.NewRNG(1)
+		if play, ok := strategy(state, "p1", &rng); ok {
+			t.Errorf("%s played %+v, want no play", name, play)
+		}
+	}
+}
+
+func TestLookaheadAvoidsImmediateLoss(t *testing.T) {
+	max := Engine.Card{Value: Engine.SpecialMax, IsSpecial: true}
+	tests := []struct {
+		name  string
+		state Engine.State
+		avoid Engine.PlayCard
+	}{
+		{
+			// max would leave a 7 that cannot be played on 99
+			name:  "max with nothing to go lower",
+			state: running(80, []Engine.Card{max, number(7)}, []Engine.Card{number(-2)}, []Engine.Card{number(6)}),
+			avoid: Engine.PlayCard{PlayerId: "p1", Card: max},
+		},
+		{
+			// choosing up would leave a 5 that cannot be played on 95
+			name:  "choose up with nothing to follow",
+			state: running(85, []Engine.Card{Engine.ChooseCard, number(5)}, []Engine.Card{number(-1)}),
+			avoid: Engine.PlayCard{PlayerId: "p1", Card: Engine.ChooseCard, Choice: Engine.ChooseUp},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rng := Engine.NewRNG(1)
+			play, ok := Lookahead(test.state, "p1", &rng)
+			if !ok || reflect.DeepEqual(play, test.avoid) {
+				t.Fatalf("Lookahead played %+v, %v", play, ok)
+			}
+
+			// the cards kept can still be played on the stack left behind
+			stack := Engine.StackAfter(test.state, play)
+			keep := without(test.state.Players[0].Cards, play.Card)
+			if !playable(test.state.Rules, stack, keep) {
+				t.Errorf("kept %v on %d", keep, stack)
+			}
+		})
+	}
+}
+
+// apply applies an action the test expects to be valid
+func apply(t *testing.T, state Engine.State, action Engine.Action) Engine.State {
+	t.Helper()
+	next, _, err := Engine.Apply(state, action)
+	if err != nil {
+		t.Fatalf("Apply(%T) = %v", action, err)
+	}
+	return next
+}
+
+func contains(plays []Engine.PlayCard, play Engine.PlayCard) bool {
+	for _, p := range plays {
+		if reflect.DeepEqual(p, play) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package engine
+
+// Action is a change requested by a player, see Apply
+type Action interface {
+	isAction()
+}
+
+// Join adds a player to a waiting game, joining again reconnects
+type Join struct {
+	PlayerId        string
+	PlayerName      string
+	PlayerAvatarURL string
+}
+
+// Leave removes a player from a waiting game, or puts them out of a running one
+type Leave struct {
+	PlayerId string
+}
+
+// SetRules changes the rules of a game that has not started
+type SetRules struct {
+	Rules Rules
+}
+
+// Start deals the cards, who may start the game is up to the caller
+type Start struct{}
+
+// PlayCard plays a card from the hand of the current player. Choice is the
+// value a choose card is played as, TargetId the player a target card makes
+// play next.
+type PlayCard struct {
+	PlayerId string
+	Card     Card
+	Choice   int
+	TargetId string
+}
+
+// Timeout ends the turn of the current player when their clock runs out, the
+// clock itself is kept by the caller
+type Timeout struct {
+	PlayerId string
+}
+
+func (Join) isAction()     {}
+func (Leave) isAction()    {}
+func (SetRules) isAction() {}
+func (Start) isAction()    {}
+func (PlayCard) isAction() {}
+func (Timeout) isAction()  {}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Card struct {
+	Value     int  `json:"value"`
+	IsSpecial bool `json:"isSpecial"`
+}
+
+// values of the special cards
+const (
+	SpecialPass    = 0 // nothing happens
+	SpecialReverse = 1 // reverses the direction of play
+	SpecialShuffle = 2 // shuffles the seats
+	SpecialMax     = 3 // sets the stack to the maximum
+	SpecialChoose  = 4 // adds 10 or subtracts 10, as the player chooses
+	SpecialSkip    = 5 // the next player loses their turn
+	SpecialTarget  = 6 // a player of the player's choice plays next
+)
+
+// ChooseUp and ChooseDown are the choices for a choose card
+const (
+	ChooseUp   = 10
+	ChooseDown = -10
+)
+
+var (
+	ChooseCard = Card{Value: SpecialChoose, IsSpecial: true}
+	SkipCard   = Card{Value: SpecialSkip, IsSpecial: true}
+	TargetCard = Card{Value: SpecialTarget, IsSpecial: true}
+)
+
+var specialNames = map[int]string{
+	SpecialPass:    "pass",
+	SpecialReverse: "reverse",
+	SpecialShuffle: "shuffle",
+	SpecialMax:     "max",
+	SpecialChoose:  "choose",
+	SpecialSkip:    "skip",
+	SpecialTarget:  "target",
+}
+
+// NoCard is the LastPlayedCard before anything is played
+var NoCard = Card{Value: -1, IsSpecial: true}
+
+// PlayedCard is a card with the choice its player made
+type PlayedCard struct {
+	Card
+	Choice   int    `json:"choice,omitempty"`   // the value a choose card was played as
+	TargetId string `json:"targetId,omitempty"` // the player a target card made play next
+}
+
+// name is how a card is written in a deck, Card has no String method so the
+// broadcast messages keep printing cards as {value isSpecial}
+func (c Card) name() string {
+	if c.IsSpecial {
+		if name, ok := specialNames[c.Value]; ok {
+			return name
+		}
+	}
+	return strconv.Itoa(c.Value)
+}
+
+// DeckEntry is how many copies of a card the deck holds
+type DeckEntry struct {
+	Card  Card `json:"card"`
+	Count int  `json:"count"`
+}
+
+// Deck is the composition the draw pile is built from at the start of a game
+type Deck []DeckEntry
+
+var DefaultDeck = Deck{
+	{Card{Value: 1}, 4}, {Card{Value: 2}, 4}, {Card{Value: 3}, 4}, {Card{Value: 4}, 4}, {Card{Value: 5}, 4},
+	{Card{Value: 6}, 4}, {Card{Value: 7}, 4}, {Card{Value: 8}, 4}, {Card{Value: 9}, 4}, {Card{Value: 10}, 4},
+	{Card{Value: -9}, 2},
+	{Card{Value: -10}, 2},
+	{Card{Value: SpecialPass, IsSpecial: true}, 4},
+	{Card{Value: SpecialReverse, IsSpecial: true}, 4},
+	{Card{Value: SpecialShuffle, IsSpecial: true}, 2},
+	{Card{Value: SpecialMax, IsSpecial: true}, 2},
+	{ChooseCard, 4},
+	{SkipCard, 2},
+	{TargetCard, 2},
+}
+
+// Size is the number of cards in the deck
+func (d Deck) Size() int {
+	size := 0
+	for _, entry := range d {
+		size += entry.Count
+	}
+	return size
+}
+
+func (d Deck) cards() []Card {
+	cards := make([]Card, 0, d.Size())
+	for _, entry := range d {
+		for i := 0; i < entry.Count; i++ {
+			cards = append(cards, entry.Card)
+		}
+	}
+	return cards
+}
+
+func (d Deck) String() string {
+	entries := []string{}
+	for _, entry := range d {
+		entries = append(entries, fmt.Sprintf("%s:%d", entry.Card.name(), entry.Count))
+	}
+	return strings.Join(entries, ",")
+}
+
+// ParseDeck reads a deck written as comma separated "card:count" pairs, where
+// a card is a number or the name of a special, e.g. "1:4,10:4,-10:2,pass:4"
+func ParseDeck(text string) (Deck, error) {
+	deck := Deck{}
+	for _, pair := range strings.Split(text, ",") {
+		name, countText, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found {
+			return nil, fmt.Errorf("deck entry %q is not card:count", pair)
+		}
+
+		card, err := parseCard(strings.TrimSpace(name))
+		if err != nil {
+			return nil, err
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(countText))
+		if err != nil || count < 0 {
+			return nil, fmt.Errorf("invalid count in deck entry %q", pair)
+		}
+
+		deck = append(deck, DeckEntry{Card: card, Count: count})
+	}
+
+	if deck.Size() == 0 {
+		return nil, fmt.Errorf("deck has no cards")
+	}
+	return deck, nil
+}
+
+func parseCard(name string) (Card, error) {
+	if card, ok := SpecialCard(strings.ToLower(name)); ok {
+		return card, nil
+	}
+
+	value, err := strconv.Atoi(name)
+	if err != nil {
+		return Card{}, fmt.Errorf("unknown card %q", name)
+	}
+	return Card{Value: value}, nil
+}
@@ -0,0 +1,591 @@
+// Package engine holds the rules of ninetynine as pure functions. Apply takes
+// a State and an Action and returns the next State with the Events it caused,
+// it never blocks, logs or touches the store. Randomness comes from the RNG
+// inside the state, so a game can be replayed from its seed and actions.
+package engine
+
+import (
+	"errors"
+	"sort"
+)
+
+// game statuses
+const (
+	StatusWaiting = "waiting"
+	StatusPlaying = "playing"
+	StatusEnded   = "ended"
+)
+
+// player statuses
+const (
+	PlayerWaiting = "waiting"
+	PlayerPlaying = "playing"
+	PlayerHasLeft = "left"
+	PlayerIsOut   = "Out"
+)
+
+var (
+	ErrGameStarted      = errors.New("game has already started")
+	ErrNotEnoughPlayers = errors.New("not enough players")
+	ErrNotPlaying       = errors.New("game is not running")
+	ErrUnknownPlayer    = errors.New("player is not in the game")
+	ErrNotYourTurn      = errors.New("not the player's turn")
+	ErrCardNotInHand    = errors.New("player does not have that card")
+	ErrStackTooHigh     = errors.New("card would take the stack over the maximum")
+	ErrInvalidChoice    = errors.New("choose card needs a choice of +10 or -10")
+	ErrInvalidTarget    = errors.New("target card needs another player that is still in")
+	ErrDeckTooSmall     = errors.New("deck is too small to deal every player a hand")
+	ErrUnknownAction    = errors.New("unknown action")
+)
+
+type Player struct {
+	PlayerId        string
+	PlayerName      string
+	PlayerAvatarURL string
+	Status          string
+	Cards           []Card
+	IsOut           bool // out of the current round
+	Lives           int  // left in the match, when the rules give lives
+	Points          int  // one for every player that went out of a round before them
+}
+
+type State struct {
+	Players            []Player
+	Status             string
+	CurrentPlayerIndex int
+	CurrentDirection   int
+	StackValue         int
+	Rules              Rules
+	Round              int // the round being played, from 1
+	LastPlayedCard     PlayedCard
+	Eliminated         []string // player ids in the order they went out of the round
+	Deck               Deck     // composition of the draw pile when the game starts
+	DrawPile           []Card   // the top card is the last one
+	DiscardPile        []Card   // shuffled into a new draw pile when it runs out
+	RNG                RNG
+}
+
+// NewState returns an empty game waiting for players
+func NewState(rng RNG) State {
+	return State{
+		Players:          []Player{},
+		Status:           StatusWaiting,
+		CurrentDirection: 1,
+		Rules:            ClassicRules,
+		LastPlayedCard:   PlayedCard{Card: NoCard},
+		Eliminated:       []string{},
+		Deck:             DefaultDeck,
+		DrawPile:         []Card{},
+		DiscardPile:      []Card{},
+		RNG:              rng,
+	}
+}
+
+// Apply returns the state after action. The given state is not modified, on
+// error it is returned unchanged with no events.
+func Apply(state State, action Action) (State, []Event, error) {
+	next := state.clone()
+
+	var events []Event
+	var err error
+	switch action := action.(type) {
+	case Join:
+		events, err = next.join(action)
+	case Leave:
+		events, err = next.leave(action.PlayerId)
+	case SetRules:
+		events, err = next.setRules(action.Rules)
+	case Start:
+		events, err = next.start()
+	case PlayCard:
+		events, err = next.play(action)
+	case Timeout:
+		events, err = next.timeout(action.PlayerId)
+	default:
+		err = ErrUnknownAction
+	}
+
+	if err != nil {
+		return state, nil, err
+	}
+	return next, events, nil
+}
+
+// clone copies the slices so the copy can be changed in place
+func (s State) clone() State {
+	s.Players = append([]Player{}, s.Players...)
+	for i := range s.Players {
+		s.Players[i].Cards = append([]Card{}, s.Players[i].Cards...)
+	}
+	s.Eliminated = append([]string{}, s.Eliminated...)
+	s.Rules.Specials = append([]int{}, s.Rules.Specials...)
+	s.DrawPile = append([]Card{}, s.DrawPile...)
+	s.DiscardPile = append([]Card{}, s.DiscardPile...)
+	return s
+}
+
+// PlayerIndex returns the seat of a player, or -1
+func (s State) PlayerIndex(playerId string) int {
+	for i, p := range s.Players {
+		if p.PlayerId == playerId {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *State) join(action Join) ([]Event, error) {
+	if i := s.PlayerIndex(action.PlayerId); i != -1 {
+		return []Event{playerEvent(PlayerReconnected, s.Players[i])}, nil
+	}
+
+	if s.Status != StatusWaiting {
+		return nil, ErrGameStarted
+	}
+
+	player := Player{
+		PlayerId:        action.PlayerId,
+		PlayerName:      action.PlayerName,
+		PlayerAvatarURL: action.PlayerAvatarURL,
+		Status:          PlayerWaiting,
+		Cards:           []Card{},
+	}
+	s.Players = append(s.Players, player)
+	return []Event{playerEvent(PlayerJoined, player)}, nil
+}
+
+func (s *State) leave(playerId string) ([]Event, error) {
+	i := s.PlayerIndex(playerId)
+	if i == -1 {
+		return nil, ErrUnknownPlayer
+	}
+	player := s.Players[i]
+
+	switch s.Status {
+	case StatusWaiting:
+		s.Players = append(s.Players[:i], s.Players[i+1:]...)
+		return []Event{playerEvent(PlayerLeft, player)}, nil
+	case StatusEnded:
+		return []Event{playerEvent(PlayerLeft, player)}, nil
+	}
+
+	if !player.IsOut {
+		s.Eliminated = append(s.Eliminated, playerId)
+		s.scoreOut(i)
+	}
+	s.discardHand(i)
+	s.Players[i].IsOut = true
+	s.Players[i].Status = PlayerHasLeft
+	s.Players[i].Lives = 0
+	events := []Event{playerEvent(PlayerLeft, player)}
+
+	if i == s.CurrentPlayerIndex {
+		return append(events, s.nextPlayer()...), nil
+	}
+
+	if s.isEnded() {
+		return append(events, s.endRound()...), nil
+	}
+	return events, nil
+}
+
+func (s *State) setRules(rules Rules) ([]Event, error) {
+	if s.Status != StatusWaiting {
+		return nil, ErrGameStarted
+	}
+
+	s.Rules = rules
+	s.Rules.Specials = append([]int{}, rules.Specials...)
+	return []Event{{Kind: RulesChanged}}, nil
+}
+
+func (s *State) start() ([]Event, error) {
+	if s.Status != StatusWaiting {
+		return nil, ErrGameStarted
+	}
+
+	if len(s.Players) < 2 {
+		return nil, ErrNotEnoughPlayers
+	}
+
+	// a played card must be replaceable even when every other card is in a hand
+	deck := s.Deck.filter(s.Rules)
+	if deck.Size() <= len(s.Players)*s.Rules.HandSize {
+		return nil, ErrDeckTooSmall
+	}
+
+	s.Status = StatusPlaying
+	s.Round = 0
+	for i := range s.Players {
+		s.Players[i].Lives = s.Rules.Lives
+		s.Players[i].Points = 0
+	}
+
+	events := []Event{{Kind: GameStarted}}
+	return append(events, s.startRound()...), nil
+}
+
+func (s *State) play(play PlayCard) ([]Event, error) {
+	if err := ValidatePlay(*s, play); err != nil {
+		return nil, err
+	}
+
+	player := s.Players[s.CurrentPlayerIndex]
+	played := PlayedCard{Card: play.Card}
+	switch {
+	case play.Card == ChooseCard:
+		played.Choice = play.Choice
+	case play.Card == TargetCard:
+		played.TargetId = play.TargetId
+	}
+	s.LastPlayedCard = played
+
+	events := []Event{{Kind: CardPlayed, PlayerId: player.PlayerId, PlayerName: player.PlayerName, Card: played}}
+	events = append(events, s.playCard(played)...)
+
+	switch play.Card {
+	case SkipCard:
+		events = append(events, s.skipPlayer())
+		return append(events, s.nextPlayer()...), nil
+	case TargetCard:
+		s.CurrentPlayerIndex = s.PlayerIndex(play.TargetId)
+		return append(events, s.settleTurn()...), nil
+	}
+	return append(events, s.nextPlayer()...), nil
+}
+
+// timeout ends the turn of a player whose clock ran out, by playing their
+// lowest card or putting them out as the rules say
+func (s *State) timeout(playerId string) ([]Event, error) {
+	if s.Status != StatusPlaying {
+		return nil, ErrNotPlaying
+	}
+
+	current := s.Players[s.CurrentPlayerIndex]
+	if current.PlayerId != playerId {
+		return nil, ErrNotYourTurn
+	}
+
+	events := []Event{playerEvent(TurnTimedOut, current)}
+	if s.Rules.OnTimeout != OnTimeoutOut {
+		if play, ok := LowestPlay(*s, playerId); ok {
+			played, err := s.play(play)
+			return append(events, played...), err
+		}
+	}
+
+	events = append(events, s.putOut(s.CurrentPlayerIndex)...)
+	return append(events, s.nextPlayer()...), nil
+}
+
+// ValidatePlay checks that the player may play the card now, with the
+// choice or target the card needs
+func ValidatePlay(state State, play PlayCard) error {
+	if state.Status != StatusPlaying {
+		return ErrNotPlaying
+	}
+
+	// check if it's player turn
+	current := state.Players[state.CurrentPlayerIndex]
+	if current.PlayerId != play.PlayerId {
+		return ErrNotYourTurn
+	}
+
+	// check if player has that card
+	if indexOfCard(current.Cards, play.Card) == -1 {
+		return ErrCardNotInHand
+	}
+
+	switch {
+	case !play.Card.IsSpecial:
+		if !state.stackAllows(play.Card.Value) {
+			return ErrStackTooHigh
+		}
+	case play.Card == ChooseCard:
+		if play.Choice != ChooseUp && play.Choice != ChooseDown {
+			return ErrInvalidChoice
+		}
+		if !state.stackAllows(play.Choice) {
+			return ErrStackTooHigh
+		}
+	case play.Card == TargetCard:
+		target := state.PlayerIndex(play.TargetId)
+		if target == -1 || target == state.CurrentPlayerIndex || state.Players[target].IsOut {
+			return ErrInvalidTarget
+		}
+	}
+
+	// other specials can always be played
+	return nil
+}
+
+// LegalPlays returns every play the player can make now, one per choice or
+// target for the cards that need one
+func LegalPlays(state State, playerId string) []PlayCard {
+	i := state.PlayerIndex(playerId)
+	if i == -1 {
+		return []PlayCard{}
+	}
+
+	legal := []PlayCard{}
+	for _, card := range state.Players[i].Cards {
+		candidates := []PlayCard{{PlayerId: playerId, Card: card}}
+		switch card {
+		case ChooseCard:
+			candidates = []PlayCard{
+				{PlayerId: playerId, Card: card, Choice: ChooseUp},
+				{PlayerId: playerId, Card: card, Choice: ChooseDown},
+			}
+		case TargetCard:
+			candidates = []PlayCard{}
+			for _, p := range state.Players {
+				candidates = append(candidates, PlayCard{PlayerId: playerId, Card: card, TargetId: p.PlayerId})
+			}
+		}
+
+		for _, play := range candidates {
+			if ValidatePlay(state, play) == nil {
+				legal = append(legal, play)
+			}
+		}
+	}
+	return legal
+}
+
+// LowestPlay returns the legal play that leaves the stack lowest, the first
+// one in hand order on ties
+func LowestPlay(state State, playerId string) (PlayCard, bool) {
+	plays := LegalPlays(state, playerId)
+	if len(plays) == 0 {
+		return PlayCard{}, false
+	}
+
+	lowest := plays[0]
+	for _, play := range plays[1:] {
+		if StackAfter(state, play) < StackAfter(state, lowest) {
+			lowest = play
+		}
+	}
+	return lowest, true
+}
+
+// StackAfter is the stack value a legal play leaves
+func StackAfter(state State, play PlayCard) int {
+	value := 0
+	switch {
+	case !play.Card.IsSpecial:
+		value = play.Card.Value
+	case play.Card == ChooseCard:
+		value = play.Choice
+	case play.Card.Value == SpecialMax:
+		return state.Rules.TargetValue
+	}
+
+	stack := state.StackValue + value
+	if stack == state.Rules.TargetValue && state.Rules.AtLimit == AtLimitReset {
+		return 0
+	}
+	return stack
+}
+
+// Unseen returns the cards a player cannot see, the draw pile and the hands
+// of the others, sorted so it tells no more than counting the deck does
+func Unseen(state State, playerId string) []Card {
+	unseen := append([]Card{}, state.DrawPile...)
+	for _, p := range state.Players {
+		if p.PlayerId != playerId {
+			unseen = append(unseen, p.Cards...)
+		}
+	}
+
+	sort.Slice(unseen, func(i, j int) bool {
+		if unseen[i].IsSpecial != unseen[j].IsSpecial {
+			return !unseen[i].IsSpecial
+		}
+		return unseen[i].Value < unseen[j].Value
+	})
+	return unseen
+}
+
+// stackAllows reports whether value can be added to the stack
+func (s State) stackAllows(value int) bool {
+	stack := s.StackValue + value
+	if stack == s.Rules.TargetValue {
+		return s.Rules.AtLimit != AtLimitForbidden
+	}
+	return stack < s.Rules.TargetValue
+}
+
+// playCard applies the effect of a card played by the current player, puts
+// it on the discard pile and replaces it in their hand from the draw pile.
+// Skip and target cards change whose turn it is, play handles that.
+func (s *State) playCard(played PlayedCard) []Event {
+	events := []Event{}
+	card := played.Card
+	if !card.IsSpecial {
+		events = append(events, s.addToStack(card.Value)...)
+	} else {
+		switch card.Value {
+		case SpecialPass:
+		case SpecialReverse:
+			s.CurrentDirection *= -1
+		case SpecialShuffle:
+			s.shufflePlayers()
+		case SpecialMax:
+			s.StackValue = s.Rules.TargetValue
+		case SpecialChoose:
+			events = append(events, s.addToStack(played.Choice)...)
+		}
+	}
+
+	current := &s.Players[s.CurrentPlayerIndex]
+	i := indexOfCard(current.Cards, card)
+	s.DiscardPile = append(s.DiscardPile, card)
+
+	replacement, reshuffled, ok := s.draw()
+	if ok {
+		current.Cards[i] = replacement
+	} else {
+		current.Cards = append(current.Cards[:i], current.Cards[i+1:]...)
+	}
+
+	if reshuffled {
+		events = append(events, Event{Kind: DeckReshuffled})
+	}
+	return events
+}
+
+func (s *State) addToStack(value int) []Event {
+	s.StackValue += value
+	if s.StackValue == s.Rules.TargetValue && s.Rules.AtLimit == AtLimitReset {
+		s.StackValue = 0
+		return []Event{{Kind: StackReset}}
+	}
+	return nil
+}
+
+// draw takes the top card of the draw pile, shuffling the discard pile into
+// a new draw pile first when it is empty. ok is false if both are empty.
+func (s *State) draw() (card Card, reshuffled bool, ok bool) {
+	if len(s.DrawPile) == 0 {
+		if len(s.DiscardPile) == 0 {
+			return Card{}, false, false
+		}
+
+		s.DrawPile, s.DiscardPile = s.DiscardPile, []Card{}
+		s.RNG.Shuffle(len(s.DrawPile), func(i, j int) { s.DrawPile[i], s.DrawPile[j] = s.DrawPile[j], s.DrawPile[i] })
+		reshuffled = true
+	}
+
+	last := len(s.DrawPile) - 1
+	card = s.DrawPile[last]
+	s.DrawPile = s.DrawPile[:last]
+	return card, reshuffled, true
+}
+
+// discardHand puts the cards of a player that is out on the discard pile
+func (s *State) discardHand(index int) {
+	s.DiscardPile = append(s.DiscardPile, s.Players[index].Cards...)
+	s.Players[index].Cards = []Card{}
+}
+
+// nextPlayer passes the turn on
+func (s *State) nextPlayer() []Event {
+	s.advance()
+	return s.settleTurn()
+}
+
+// settleTurn gives the turn to the current player if they can play. Players
+// that cannot play any card when their turn comes are out and the turn moves
+// on, the game ends when one player is left.
+func (s *State) settleTurn() []Event {
+	events := []Event{}
+	for range s.Players {
+		if s.isEnded() {
+			return append(events, s.endRound()...)
+		}
+
+		if s.canPlay(s.CurrentPlayerIndex) {
+			break
+		}
+
+		if !s.Players[s.CurrentPlayerIndex].IsOut {
+			events = append(events, s.putOut(s.CurrentPlayerIndex)...)
+		}
+
+		s.advance()
+	}
+	return events
+}
+
+// putOut eliminates a player that is still in the round
+func (s *State) putOut(index int) []Event {
+	events := s.scoreOut(index)
+	s.discardHand(index)
+	player := &s.Players[index]
+	player.IsOut = true
+	player.Status = PlayerIsOut
+	s.Eliminated = append(s.Eliminated, player.PlayerId)
+	return append([]Event{playerEvent(PlayerOut, *player)}, events...)
+}
+
+// skipPlayer moves the turn to the next player that is still in, whose turn
+// is then skipped by nextPlayer
+func (s *State) skipPlayer() Event {
+	for range s.Players {
+		s.advance()
+		if !s.Players[s.CurrentPlayerIndex].IsOut {
+			break
+		}
+	}
+	return playerEvent(PlayerSkipped, s.Players[s.CurrentPlayerIndex])
+}
+
+func (s *State) advance() {
+	s.CurrentPlayerIndex += s.CurrentDirection
+	if s.CurrentPlayerIndex < 0 {
+		s.CurrentPlayerIndex = len(s.Players) - 1
+	} else if s.CurrentPlayerIndex >= len(s.Players) {
+		s.CurrentPlayerIndex = 0
+	}
+}
+
+// shufflePlayers shuffles the seats, the current player keeps the turn
+func (s *State) shufflePlayers() {
+	currentPlayerId := s.Players[s.CurrentPlayerIndex].PlayerId
+	s.RNG.Shuffle(len(s.Players), func(i, j int) { s.Players[i], s.Players[j] = s.Players[j], s.Players[i] })
+	s.CurrentPlayerIndex = s.PlayerIndex(currentPlayerId)
+}
+
+func (s State) canPlay(index int) bool {
+	player := s.Players[index]
+	if player.IsOut {
+		return false
+	}
+	return len(LegalPlays(s, player.PlayerId)) > 0
+}
+
+// isEnded reports whether the round is over
+func (s State) isEnded() bool {
+	remaining := 0
+	for _, p := range s.Players {
+		if !p.IsOut {
+			remaining++
+		}
+	}
+	return remaining <= 1
+}
+
+func (s *State) end() Event {
+	s.Status = StatusEnded
+	return Event{Kind: GameEnded}
+}
+
+func indexOfCard(cards []Card, card Card) int {
+	for i, c := range cards {
+		if c == card {
+			return i
+		}
+	}
+	return -1
+}
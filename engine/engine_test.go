@@ -0,0 +1,754 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func number(value int) Card {
+	return Card{Value: value}
+}
+
+func special(value int) Card {
+	return Card{Value: value, IsSpecial: true}
+}
+
+// running returns a game in its first round where the first player has the
+// turn. The draw pile holds cards of 1, so replacements are easy to follow.
+func running(rules Rules, stack int, hands ...[]Card) State {
+	state := NewState(NewRNG(1))
+	state.Rules = rules
+	state.Status = StatusPlaying
+	state.Round = 1
+	state.StackValue = stack
+	state.DrawPile = []Card{number(1), number(1), number(1), number(1)}
+	for i, hand := range hands {
+		state.Players = append(state.Players, Player{
+			PlayerId:   fmt.Sprintf("p%d", i+1),
+			PlayerName: fmt.Sprintf("Player %d", i+1),
+			Status:     PlayerPlaying,
+			Cards:      hand,
+			Lives:      rules.Lives,
+		})
+	}
+	return state
+}
+
+// waiting returns a game that has not started with count players joined
+func waiting(rules Rules, count int) State {
+	state := NewState(NewRNG(1))
+	state.Rules = rules
+	for i := 0; i < count; i++ {
+		state, _, _ = Apply(state, Join{PlayerId: fmt.Sprintf("p%d", i+1), PlayerName: fmt.Sprintf("Player %d", i+1)})
+	}
+	return state
+}
+
+func withRules(change func(rules *Rules)) Rules {
+	rules := ClassicRules
+	rules.Specials = append([]int{}, ClassicRules.Specials...)
+	change(&rules)
+	return rules
+}
+
+func kinds(events []Event) []EventKind {
+	result := []EventKind{}
+	for _, event := range events {
+		result = append(result, event.Kind)
+	}
+	return result
+}
+
+func TestApply(t *testing.T) {
+	started, _, _ := Apply(waiting(ClassicRules, 2), Start{})
+	match := withRules(func(rules *Rules) { rules.Rounds = 3; rules.Lives = 2 })
+	lastLife := running(match, 90, []Card{number(9), number(2)}, []Card{number(5)})
+	lastLife.Players[1].Lives = 1
+	lastRound := running(withRules(func(rules *Rules) { rules.Rounds = 2 }), 90, []Card{number(9), number(2)}, []Card{number(5)})
+	lastRound.Round = 2
+	reshuffle := running(ClassicRules, 0, []Card{number(5), number(2)}, []Card{number(3)})
+	reshuffle.DrawPile = []Card{}
+	reshuffle.DiscardPile = []Card{number(1), number(2), number(3), number(4)}
+	reshuffle.RNG = NewRNG(42)
+	targetOut := running(ClassicRules, 0, []Card{TargetCard, number(2)}, []Card{number(3)}, []Card{number(4)})
+	targetOut.Players[2].IsOut = true
+
+	tests := []struct {
+		name   string
+		state  State
+		action Action
+		err    error
+		events []EventKind
+		check  func(t *testing.T, state State)
+	}{
+		{
+			name:   "join adds a waiting player",
+			state:  waiting(ClassicRules, 1),
+			action: Join{PlayerId: "p2", PlayerName: "Player 2"},
+			events: []EventKind{PlayerJoined},
+			check: func(t *testing.T, state State) {
+				if len(state.Players) != 2 || state.Players[1].Status != PlayerWaiting {
+					t.Errorf("players %+v, want p2 waiting", state.Players)
+				}
+			},
+		},
+		{
+			name:   "join again reconnects",
+			state:  started,
+			action: Join{PlayerId: "p1", PlayerName: "Player 1"},
+			events: []EventKind{PlayerReconnected},
+		},
+		{
+			name:   "join after the start",
+			state:  started,
+			action: Join{PlayerId: "p3", PlayerName: "Player 3"},
+			err:    ErrGameStarted,
+		},
+		{
+			name:   "rules change before the start",
+			state:  waiting(ClassicRules, 2),
+			action: SetRules{Rules: withRules(func(rules *Rules) { rules.TargetValue = 50 })},
+			events: []EventKind{RulesChanged},
+			check: func(t *testing.T, state State) {
+				if state.Rules.TargetValue != 50 {
+					t.Errorf("target %d, want 50", state.Rules.TargetValue)
+				}
+			},
+		},
+		{
+			name:   "rules change after the start",
+			state:  started,
+			action: SetRules{Rules: ClassicRules},
+			err:    ErrGameStarted,
+		},
+		{
+			name:   "leave before the start frees the seat",
+			state:  waiting(ClassicRules, 2),
+			action: Leave{PlayerId: "p1"},
+			events: []EventKind{PlayerLeft},
+			check: func(t *testing.T, state State) {
+				if len(state.Players) != 1 || state.Players[0].PlayerId != "p2" {
+					t.Errorf("players %+v, want only p2", state.Players)
+				}
+			},
+		},
+		{
+			name:   "leave on your turn passes it on",
+			state:  running(ClassicRules, 0, []Card{number(5)}, []Card{number(3)}, []Card{number(4)}),
+			action: Leave{PlayerId: "p1"},
+			events: []EventKind{PlayerLeft},
+			check: func(t *testing.T, state State) {
+				if state.Players[0].Status != PlayerHasLeft || !state.Players[0].IsOut || state.CurrentPlayerIndex != 1 {
+					t.Errorf("player %+v current %d, want p1 gone and p2 to play", state.Players[0], state.CurrentPlayerIndex)
+				}
+			},
+		},
+		{
+			name:   "leave of a player that is not in the game",
+			state:  waiting(ClassicRules, 2),
+			action: Leave{PlayerId: "p9"},
+			err:    ErrUnknownPlayer,
+		},
+		{
+			name:   "start deals a hand to every player",
+			state:  waiting(ClassicRules, 2),
+			action: Start{},
+			events: []EventKind{GameStarted},
+			check: func(t *testing.T, state State) {
+				if state.Status != StatusPlaying || state.Round != 1 {
+					t.Errorf("status %q round %d, want playing round 1", state.Status, state.Round)
+				}
+				for _, p := range state.Players {
+					if len(p.Cards) != 3 || p.Status != PlayerPlaying {
+						t.Errorf("%s is %q with %d cards, want playing with 3", p.PlayerId, p.Status, len(p.Cards))
+					}
+				}
+				if want := DefaultDeck.filter(ClassicRules).Size() - 6; len(state.DrawPile) != want {
+					t.Errorf("draw pile holds %d cards, want %d", len(state.DrawPile), want)
+				}
+			},
+		},
+		{
+			name:   "start needs two players",
+			state:  waiting(ClassicRules, 1),
+			action: Start{},
+			err:    ErrNotEnoughPlayers,
+		},
+		{
+			name:   "start needs a card left after dealing",
+			state:  waiting(withRules(func(rules *Rules) { rules.HandSize = 28 }), 2),
+			action: Start{},
+			err:    ErrDeckTooSmall,
+		},
+		{
+			name:   "start deals from the cards the rules keep",
+			state:  waiting(withRules(func(rules *Rules) { rules.NegativeCards = false; rules.Specials = nil }), 2),
+			action: Start{},
+			events: []EventKind{GameStarted},
+			check: func(t *testing.T, state State) {
+				cards := append([]Card{}, state.DrawPile...)
+				for _, p := range state.Players {
+					cards = append(cards, p.Cards...)
+				}
+				for _, card := range cards {
+					if card.IsSpecial || card.Value < 0 {
+						t.Errorf("dealt %v, the rules leave it out", card)
+					}
+				}
+				if len(cards) != 40 {
+					t.Errorf("dealt %d cards, want the 40 positive number cards", len(cards))
+				}
+			},
+		},
+		{
+			name:   "start of a match starts the first round",
+			state:  waiting(match, 2),
+			action: Start{},
+			events: []EventKind{GameStarted, RoundStarted},
+			check: func(t *testing.T, state State) {
+				for _, p := range state.Players {
+					if p.Lives != 2 {
+						t.Errorf("%s has %d lives, want 2", p.PlayerId, p.Lives)
+					}
+				}
+			},
+		},
+		{
+			name:   "start twice",
+			state:  started,
+			action: Start{},
+			err:    ErrGameStarted,
+		},
+		{
+			name:   "number card adds to the stack and passes the turn",
+			state:  running(ClassicRules, 10, []Card{number(5), number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: number(5)},
+			events: []EventKind{CardPlayed},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 15 || state.CurrentPlayerIndex != 1 {
+					t.Errorf("stack %d current %d, want 15 and 1", state.StackValue, state.CurrentPlayerIndex)
+				}
+				if !reflect.DeepEqual(state.Players[0].Cards, []Card{number(1), number(2)}) || state.LastPlayedCard.Card != number(5) {
+					t.Errorf("hand %v last played %v, want the card replaced from the draw pile", state.Players[0].Cards, state.LastPlayedCard)
+				}
+				if !reflect.DeepEqual(state.DiscardPile, []Card{number(5)}) {
+					t.Errorf("discard pile %v, want the played card", state.DiscardPile)
+				}
+			},
+		},
+		{
+			name:   "card over the target",
+			state:  running(ClassicRules, 95, []Card{number(5), number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: number(5)},
+			err:    ErrStackTooHigh,
+		},
+		{
+			name:   "play out of turn",
+			state:  running(ClassicRules, 0, []Card{number(5)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p2", Card: number(3)},
+			err:    ErrNotYourTurn,
+		},
+		{
+			name:   "card not in hand",
+			state:  running(ClassicRules, 0, []Card{number(5)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: number(3)},
+			err:    ErrCardNotInHand,
+		},
+		{
+			name:   "play before the start",
+			state:  waiting(ClassicRules, 2),
+			action: PlayCard{PlayerId: "p1", Card: number(3)},
+			err:    ErrNotPlaying,
+		},
+		{
+			name:   "reverse turns the direction",
+			state:  running(ClassicRules, 0, []Card{special(SpecialReverse)}, []Card{number(3)}, []Card{number(4)}),
+			action: PlayCard{PlayerId: "p1", Card: special(SpecialReverse)},
+			events: []EventKind{CardPlayed},
+			check: func(t *testing.T, state State) {
+				if state.CurrentDirection != -1 || state.CurrentPlayerIndex != 2 {
+					t.Errorf("direction %d current %d, want -1 and 2", state.CurrentDirection, state.CurrentPlayerIndex)
+				}
+			},
+		},
+		{
+			name:   "max puts out the players that cannot go lower",
+			state:  running(ClassicRules, 0, []Card{special(SpecialMax)}, []Card{number(3)}, []Card{number(-9)}),
+			action: PlayCard{PlayerId: "p1", Card: special(SpecialMax)},
+			events: []EventKind{CardPlayed, PlayerOut},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 99 || !state.Players[1].IsOut || state.CurrentPlayerIndex != 2 {
+					t.Errorf("stack %d p2 out %v current %d, want 99, p2 out and p3 to play", state.StackValue, state.Players[1].IsOut, state.CurrentPlayerIndex)
+				}
+			},
+		},
+		{
+			name:   "exactly the target is allowed",
+			state:  running(ClassicRules, 90, []Card{number(9), number(2)}, []Card{number(3)}, []Card{number(-9)}),
+			action: PlayCard{PlayerId: "p1", Card: number(9)},
+			events: []EventKind{CardPlayed, PlayerOut},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 99 || state.CurrentPlayerIndex != 2 {
+					t.Errorf("stack %d current %d, want 99 and 2", state.StackValue, state.CurrentPlayerIndex)
+				}
+			},
+		},
+		{
+			name:   "exactly the target is forbidden",
+			state:  running(withRules(func(rules *Rules) { rules.AtLimit = AtLimitForbidden }), 90, []Card{number(9)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: number(9)},
+			err:    ErrStackTooHigh,
+		},
+		{
+			name:   "exactly the target resets the stack",
+			state:  running(withRules(func(rules *Rules) { rules.AtLimit = AtLimitReset }), 90, []Card{number(9)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: number(9)},
+			events: []EventKind{CardPlayed, StackReset},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 0 {
+					t.Errorf("stack %d, want 0", state.StackValue)
+				}
+			},
+		},
+		{
+			name:   "max takes the stack to the target of the rules",
+			state:  running(withRules(func(rules *Rules) { rules.TargetValue = 50 }), 0, []Card{special(SpecialMax)}, []Card{number(-9)}),
+			action: PlayCard{PlayerId: "p1", Card: special(SpecialMax)},
+			events: []EventKind{CardPlayed},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 50 {
+					t.Errorf("stack %d, want 50", state.StackValue)
+				}
+			},
+		},
+		{
+			name:   "last player that can play wins",
+			state:  running(ClassicRules, 90, []Card{number(9), number(2)}, []Card{number(5)}),
+			action: PlayCard{PlayerId: "p1", Card: number(9)},
+			events: []EventKind{CardPlayed, PlayerOut, GameEnded},
+			check: func(t *testing.T, state State) {
+				if state.Status != StatusEnded {
+					t.Errorf("status %q, want ended", state.Status)
+				}
+				if !reflect.DeepEqual(state.Eliminated, []string{"p2"}) {
+					t.Errorf("eliminated %v, want [p2]", state.Eliminated)
+				}
+				if !reflect.DeepEqual(state.DiscardPile, []Card{number(9), number(5)}) {
+					t.Errorf("discard pile %v, want the played card and the hand of p2", state.DiscardPile)
+				}
+			},
+		},
+		{
+			name:   "skip passes over the next player",
+			state:  running(ClassicRules, 0, []Card{SkipCard, number(2)}, []Card{number(3)}, []Card{number(4)}),
+			action: PlayCard{PlayerId: "p1", Card: SkipCard},
+			events: []EventKind{CardPlayed, PlayerSkipped},
+			check: func(t *testing.T, state State) {
+				if state.CurrentPlayerIndex != 2 {
+					t.Errorf("current %d, want 2", state.CurrentPlayerIndex)
+				}
+			},
+		},
+		{
+			name:   "skip with two players comes back around",
+			state:  running(ClassicRules, 0, []Card{SkipCard, number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: SkipCard},
+			events: []EventKind{CardPlayed, PlayerSkipped},
+			check: func(t *testing.T, state State) {
+				if state.CurrentPlayerIndex != 0 {
+					t.Errorf("current %d, want 0", state.CurrentPlayerIndex)
+				}
+			},
+		},
+		{
+			name:   "target gives the turn to the target",
+			state:  running(ClassicRules, 0, []Card{TargetCard, number(2)}, []Card{number(3)}, []Card{number(4)}),
+			action: PlayCard{PlayerId: "p1", Card: TargetCard, TargetId: "p3"},
+			events: []EventKind{CardPlayed},
+			check: func(t *testing.T, state State) {
+				if state.CurrentPlayerIndex != 2 || state.LastPlayedCard.TargetId != "p3" {
+					t.Errorf("current %d target %q, want 2 and p3", state.CurrentPlayerIndex, state.LastPlayedCard.TargetId)
+				}
+			},
+		},
+		{
+			name:   "target needs another player",
+			state:  running(ClassicRules, 0, []Card{TargetCard, number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: TargetCard, TargetId: "p1"},
+			err:    ErrInvalidTarget,
+		},
+		{
+			name:   "target needs a player in the game",
+			state:  running(ClassicRules, 0, []Card{TargetCard, number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: TargetCard, TargetId: "p9"},
+			err:    ErrInvalidTarget,
+		},
+		{
+			name:   "target needs a player still in",
+			state:  targetOut,
+			action: PlayCard{PlayerId: "p1", Card: TargetCard, TargetId: "p3"},
+			err:    ErrInvalidTarget,
+		},
+		{
+			name:   "choose down",
+			state:  running(ClassicRules, 50, []Card{ChooseCard, number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: ChooseCard, Choice: ChooseDown},
+			events: []EventKind{CardPlayed},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 40 || state.LastPlayedCard.Choice != ChooseDown {
+					t.Errorf("stack %d choice %d, want 40 and %d", state.StackValue, state.LastPlayedCard.Choice, ChooseDown)
+				}
+			},
+		},
+		{
+			name:   "choose up to the target resets the stack",
+			state:  running(withRules(func(rules *Rules) { rules.AtLimit = AtLimitReset }), 89, []Card{ChooseCard, number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: ChooseCard, Choice: ChooseUp},
+			events: []EventKind{CardPlayed, StackReset},
+		},
+		{
+			name:   "choose up over the target",
+			state:  running(ClassicRules, 95, []Card{ChooseCard, number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: ChooseCard, Choice: ChooseUp},
+			err:    ErrStackTooHigh,
+		},
+		{
+			name:   "choose needs a choice",
+			state:  running(ClassicRules, 50, []Card{ChooseCard, number(2)}, []Card{number(3)}),
+			action: PlayCard{PlayerId: "p1", Card: ChooseCard, Choice: 3},
+			err:    ErrInvalidChoice,
+		},
+		{
+			name:   "timeout plays the lowest card",
+			state:  running(ClassicRules, 10, []Card{number(7), number(2), number(3)}, []Card{number(3)}),
+			action: Timeout{PlayerId: "p1"},
+			events: []EventKind{TurnTimedOut, CardPlayed},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 12 || state.CurrentPlayerIndex != 1 {
+					t.Errorf("stack %d current %d, want 12 and 1", state.StackValue, state.CurrentPlayerIndex)
+				}
+			},
+		},
+		{
+			name:   "timeout chooses down",
+			state:  running(ClassicRules, 50, []Card{number(5), ChooseCard}, []Card{number(3)}),
+			action: Timeout{PlayerId: "p1"},
+			events: []EventKind{TurnTimedOut, CardPlayed},
+			check: func(t *testing.T, state State) {
+				if state.StackValue != 40 {
+					t.Errorf("stack %d, want 40", state.StackValue)
+				}
+			},
+		},
+		{
+			name:   "timeout puts the player out",
+			state:  running(withRules(func(rules *Rules) { rules.OnTimeout = OnTimeoutOut }), 10, []Card{number(7)}, []Card{number(3)}, []Card{number(4)}),
+			action: Timeout{PlayerId: "p1"},
+			events: []EventKind{TurnTimedOut, PlayerOut},
+			check: func(t *testing.T, state State) {
+				if !state.Players[0].IsOut || len(state.Players[0].Cards) != 0 || state.CurrentPlayerIndex != 1 {
+					t.Errorf("player %+v current %d, want p1 out and p2 to play", state.Players[0], state.CurrentPlayerIndex)
+				}
+				if state.Players[1].Points != 1 || state.Players[2].Points != 1 {
+					t.Errorf("points %d and %d, want 1 for the players still in", state.Players[1].Points, state.Players[2].Points)
+				}
+			},
+		},
+		{
+			name:   "timeout of the second to last player ends the game",
+			state:  running(withRules(func(rules *Rules) { rules.OnTimeout = OnTimeoutOut }), 10, []Card{number(7)}, []Card{number(3)}),
+			action: Timeout{PlayerId: "p1"},
+			events: []EventKind{TurnTimedOut, PlayerOut, GameEnded},
+		},
+		{
+			name:   "timeout of another player",
+			state:  running(ClassicRules, 10, []Card{number(7)}, []Card{number(3)}),
+			action: Timeout{PlayerId: "p2"},
+			err:    ErrNotYourTurn,
+		},
+		{
+			name:   "timeout before the start",
+			state:  waiting(ClassicRules, 2),
+			action: Timeout{PlayerId: "p1"},
+			err:    ErrNotPlaying,
+		},
+		{
+			name:   "losing a round costs a life and starts the next",
+			state:  running(match, 90, []Card{number(9), number(2)}, []Card{number(5)}),
+			action: PlayCard{PlayerId: "p1", Card: number(9)},
+			events: []EventKind{CardPlayed, PlayerOut, LifeLost, RoundEnded, RoundStarted},
+			check: func(t *testing.T, state State) {
+				if state.Round != 2 || state.StackValue != 0 || state.CurrentPlayerIndex != 0 {
+					t.Errorf("round %d stack %d current %d, want round 2 started by p1", state.Round, state.StackValue, state.CurrentPlayerIndex)
+				}
+				if state.Players[0].Points != 1 || state.Players[1].Lives != 1 {
+					t.Errorf("p1 points %d p2 lives %d, want 1 and 1", state.Players[0].Points, state.Players[1].Lives)
+				}
+				for _, p := range state.Players {
+					if p.IsOut || len(p.Cards) != 3 {
+						t.Errorf("%s out %v with %d cards, want a new hand", p.PlayerId, p.IsOut, len(p.Cards))
+					}
+				}
+			},
+		},
+		{
+			name:   "losing the last life ends the match",
+			state:  lastLife,
+			action: PlayCard{PlayerId: "p1", Card: number(9)},
+			events: []EventKind{CardPlayed, PlayerOut, LifeLost, PlayerEliminated, RoundEnded, GameEnded},
+			check: func(t *testing.T, state State) {
+				if state.Status != StatusEnded || state.Players[1].Lives != 0 {
+					t.Errorf("status %q p2 lives %d, want ended and 0", state.Status, state.Players[1].Lives)
+				}
+			},
+		},
+		{
+			name:   "the last round ends the match",
+			state:  lastRound,
+			action: PlayCard{PlayerId: "p1", Card: number(9)},
+			events: []EventKind{CardPlayed, PlayerOut, RoundEnded, GameEnded},
+			check: func(t *testing.T, state State) {
+				if state.Players[0].Points != 1 || state.Players[1].Lives != 0 {
+					t.Errorf("p1 points %d p2 lives %d, want 1 and 0", state.Players[0].Points, state.Players[1].Lives)
+				}
+			},
+		},
+		{
+			name:   "an empty draw pile is refilled from the discard pile",
+			state:  reshuffle,
+			action: PlayCard{PlayerId: "p1", Card: number(5)},
+			events: []EventKind{CardPlayed, DeckReshuffled},
+			check: func(t *testing.T, state State) {
+				if len(state.DiscardPile) != 0 {
+					t.Errorf("discard pile %v, want it empty", state.DiscardPile)
+				}
+				// the seed fixes the order, a change here breaks replays of stored games
+				want := []Card{number(2), number(3), number(1), number(5)}
+				if !reflect.DeepEqual(state.DrawPile, want) || state.Players[0].Cards[0] != number(4) {
+					t.Errorf("draw pile %v hand %v, want %v and 4 drawn", state.DrawPile, state.Players[0].Cards, want)
+				}
+			},
+		},
+		{
+			name:   "an empty draw pile is refilled from the discard pile",
+			state:  reshuffle,
+			action: PlayCard{PlayerId: "p1", Card: number(5)},
+			events: []EventKind{CardPlayed, DeckReshuffled},
+			check: func(t *testing.T, state State) {
+				if len(state.DiscardPile) != 0 {
+					t.Errorf("discard pile %v, want it empty", state.DiscardPile)
+				}
+				// the seed fixes the order, a change here breaks replays of stored games
+				want := []Card{number(2), number(3), number(1), number(5)}
+				if !reflect.DeepEqual(state.DrawPile, want) || state.Players[0].Cards[0] != number(4) {
+					t.Errorf("draw pile %v hand %v, want %v and 4 drawn", state.DrawPile, state.Players[0].Cards, want)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			next, events, err := Apply(test.state, test.action)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error %v, want %v", err, test.err)
+			}
+			if err != nil {
+				if !reflect.DeepEqual(next, test.state) || events != nil {
+					t.Errorf("failed action changed the state or returned events %v", events)
+				}
+				return
+			}
+
+			if got := kinds(events); !reflect.DeepEqual(got, test.events) {
+				t.Errorf("events %v, want %v", got, test.events)
+			}
+			if test.check != nil {
+				test.check(t, next)
+			}
+		})
+	}
+}
+
+func TestApplyKeepsState(t *testing.T) {
+	state := running(ClassicRules, 10, []Card{number(5), number(2)}, []Card{number(3)})
+	before := state.clone()
+
+	_, _, err := Apply(state, PlayCard{PlayerId: "p1", Card: number(5)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(state, before) {
+		t.Errorf("Apply changed the state it was given")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	// timeouts play the lowest card, so the seed alone decides the game
+	play := func(seed uint64) (State, []Event) {
+		state := NewState(NewRNG(seed))
+		state, _, _ = Apply(state, SetRules{Rules: withRules(func(rules *Rules) { rules.Rounds = 3; rules.Lives = 2 })})
+		for i := 1; i <= 3; i++ {
+			state, _, _ = Apply(state, Join{PlayerId: fmt.Sprintf("p%d", i)})
+		}
+
+		state, all, err := Apply(state, Start{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for turns := 0; state.Status == StatusPlaying && turns < 2000; turns++ {
+			var events []Event
+			state, events, err = Apply(state, Timeout{PlayerId: state.Players[state.CurrentPlayerIndex].PlayerId})
+			if err != nil {
+				t.Fatal(err)
+			}
+			all = append(all, events...)
+		}
+		return state, all
+	}
+
+	first, firstEvents := play(7)
+	second, secondEvents := play(7)
+	if !reflect.DeepEqual(first, second) || !reflect.DeepEqual(firstEvents, secondEvents) {
+		t.Errorf("the same seed and actions gave different games")
+	}
+	if first.Status != StatusEnded {
+		t.Errorf("status %q after the game ran out of turns, want ended", first.Status)
+	}
+}
+
+func TestRNG(t *testing.T) {
+	a, b := NewRNG(7), NewRNG(7)
+	for i := 0; i < 100; i++ {
+		value := a.Intn(10)
+		if value != b.Intn(10) {
+			t.Fatalf("generators with the same seed differ after %d numbers", i)
+		}
+		if value < 0 || value >= 10 {
+			t.Fatalf("Intn(10) returned %d", value)
+		}
+	}
+
+	// a copy carries on from the same point
+	c := a
+	if a.Intn(1000) != c.Intn(1000) {
+		t.Errorf("a copied generator gave a different number")
+	}
+
+	values := []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+	rng := NewRNG(3)
+	rng.Shuffle(len(values), func(i, j int) { values[i], values[j] = values[j], values[i] })
+	shuffled := append([]int{}, values...)
+	sort.Ints(values)
+	if !reflect.DeepEqual(values, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}) {
+		t.Errorf("shuffle gave %v, want a permutation", shuffled)
+	}
+}
+
+func TestParseDeck(t *testing.T) {
+	tests := []struct {
+		text string
+		want Deck
+	}{
+		{text: "1:4, -10:2,pass:1", want: Deck{{number(1), 4}, {number(-10), 2}, {special(SpecialPass), 1}}},
+		{text: "Reverse:2,max:0,3:1", want: Deck{{special(SpecialReverse), 2}, {special(SpecialMax), 0}, {number(3), 1}}},
+		{text: "1"},
+		{text: "jack:1"},
+		{text: "1:-1"},
+		{text: "1:0"},
+	}
+
+	for _, test := range tests {
+		deck, err := ParseDeck(test.text)
+		if test.want == nil {
+			if err == nil {
+				t.Errorf("ParseDeck(%q) = %v, want an error", test.text, deck)
+			}
+			continue
+		}
+
+		if err != nil || !reflect.DeepEqual(deck, test.want) {
+			t.Errorf("ParseDeck(%q) = %v, %v, want %v", test.text, deck, err, test.want)
+		}
+	}
+
+	// a deck reads back from how it is written
+	deck, err := ParseDeck(DefaultDeck.String())
+	if err != nil || !reflect.DeepEqual(deck, DefaultDeck) {
+		t.Errorf("ParseDeck(DefaultDeck.String()) = %v, %v", deck, err)
+	}
+}
+
+func TestLegalPlays(t *testing.T) {
+	state := running(ClassicRules, 92, []Card{number(8), ChooseCard, TargetCard}, []Card{number(3)}, []Card{number(4)})
+
+	got := []string{}
+	for _, play := range LegalPlays(state, "p1") {
+		got = append(got, fmt.Sprintf("%s/%d/%s", play.Card.name(), play.Choice, play.TargetId))
+	}
+	sort.Strings(got)
+
+	want := []string{"choose/-10/", "target/0/p2", "target/0/p3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("legal plays %v, want %v", got, want)
+	}
+}
+
+func TestStandings(t *testing.T) {
+	player := func(id string, lives int, points int) Player {
+		return Player{PlayerId: id, Status: PlayerPlaying, Lives: lives, Points: points}
+	}
+	left := player("p1", 0, 5)
+	left.Status = PlayerHasLeft
+
+	tests := []struct {
+		name       string
+		players    []Player
+		eliminated []string
+		want       []string
+	}{
+		{
+			name:    "lives first",
+			players: []Player{player("p1", 1, 3), player("p2", 2, 0)},
+			want:    []string{"p2", "p1"},
+		},
+		{
+			name:    "points on equal lives",
+			players: []Player{player("p1", 0, 1), player("p2", 0, 2)},
+			want:    []string{"p2", "p1"},
+		},
+		{
+			name:       "last round on equal points",
+			players:    []Player{player("p1", 0, 0), player("p2", 0, 0), player("p3", 0, 0)},
+			eliminated: []string{"p2", "p1"},
+			want:       []string{"p3", "p1", "p2"},
+		},
+		{
+			name:    "players that left come last",
+			players: []Player{left, player("p2", 0, 0)},
+			want:    []string{"p2", "p1"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := NewState(NewRNG(1))
+			state.Players = test.players
+			state.Eliminated = append(state.Eliminated, test.eliminated...)
+
+			got := []string{}
+			for i, standing := range Standings(state) {
+				if standing.Place != i+1 {
+					t.Errorf("%s has place %d, want %d", standing.PlayerId, standing.Place, i+1)
+				}
+				got = append(got, standing.PlayerId)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("standings %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package engine
+
+type EventKind string
+
+const (
+	PlayerJoined      EventKind = "playerJoined"
+	PlayerReconnected EventKind = "playerReconnected"
+	PlayerLeft        EventKind = "playerLeft"
+	RulesChanged      EventKind = "rulesChanged"
+	GameStarted       EventKind = "gameStarted"
+	CardPlayed        EventKind = "cardPlayed"
+	PlayerSkipped     EventKind = "playerSkipped" // lost their turn to a skip card
+	TurnTimedOut      EventKind = "turnTimedOut"  // the turn clock ran out
+	PlayerOut         EventKind = "playerOut"     // could not play any card or timed out
+	LifeLost          EventKind = "lifeLost"
+	PlayerEliminated  EventKind = "playerEliminated" // lost their last life, they sit out the rest of the match
+	RoundEnded        EventKind = "roundEnded"       // PlayerId is the winner, only in games of more than one round
+	RoundStarted      EventKind = "roundStarted"     // only in games of more than one round
+	StackReset        EventKind = "stackReset"       // a card brought the stack exactly to the target
+	DeckReshuffled    EventKind = "deckReshuffled"   // the discard pile became the draw pile
+	GameEnded         EventKind = "gameEnded"
+)
+
+// Event describes something that happened while applying an action, in the
+// order it happened
+type Event struct {
+	Kind       EventKind
+	PlayerId   string
+	PlayerName string
+	Card       PlayedCard // set for CardPlayed
+	Round      int        // set for RoundEnded and RoundStarted
+}
+
+func playerEvent(kind EventKind, p Player) Event {
+	return Event{Kind: kind, PlayerId: p.PlayerId, PlayerName: p.PlayerName}
+}
@@ -0,0 +1,157 @@
+package engine
+
+import "sort"
+
+// Standing is the place of a player in the match
+type Standing struct {
+	PlayerId   string `json:"playerId"`
+	PlayerName string `json:"playerName"`
+	Lives      int    `json:"lives"`
+	Points     int    `json:"points"`
+	Place      int    `json:"place"`
+}
+
+// startRound resets the board and deals a hand to every player still in the
+// match
+func (s *State) startRound() []Event {
+	s.Round++
+	s.StackValue = 0
+	s.CurrentDirection = 1
+	s.LastPlayedCard = PlayedCard{Card: NoCard}
+	s.Eliminated = []string{}
+	s.DrawPile = s.Deck.filter(s.Rules).cards()
+	s.DiscardPile = []Card{}
+	s.RNG.Shuffle(len(s.DrawPile), func(i, j int) { s.DrawPile[i], s.DrawPile[j] = s.DrawPile[j], s.DrawPile[i] })
+
+	for i := range s.Players {
+		player := &s.Players[i]
+		player.Cards = []Card{}
+		if !s.inMatch(*player) {
+			player.IsOut = true
+			continue
+		}
+
+		player.IsOut = false
+		player.Status = PlayerPlaying
+		for c := 0; c < s.Rules.HandSize; c++ {
+			card, _, _ := s.draw()
+			player.Cards = append(player.Cards, card)
+		}
+	}
+
+	events := []Event{}
+	if s.isMatch() {
+		events = append(events, Event{Kind: RoundStarted, Round: s.Round})
+	}
+	if !s.canPlay(s.CurrentPlayerIndex) {
+		events = append(events, s.nextPlayer()...)
+	}
+	return events
+}
+
+// endRound starts the next round, or ends the game after the last one or
+// when a single player is left in the match. The winner of a round starts
+// the next one.
+func (s *State) endRound() []Event {
+	events := []Event{}
+	if s.isMatch() {
+		event := Event{Kind: RoundEnded}
+		for i, p := range s.Players {
+			if !p.IsOut {
+				event = playerEvent(RoundEnded, p)
+				s.CurrentPlayerIndex = i
+			}
+		}
+		event.Round = s.Round
+		events = append(events, event)
+	}
+
+	remaining := 0
+	for _, p := range s.Players {
+		if s.inMatch(p) {
+			remaining++
+		}
+	}
+
+	if s.Round >= s.Rules.Rounds || remaining < 2 {
+		return append(events, s.end())
+	}
+	return append(events, s.startRound()...)
+}
+
+// scoreOut scores a player going out of the round: every player still in
+// gets a point and, when the rules give lives, the player loses one
+func (s *State) scoreOut(index int) []Event {
+	for i := range s.Players {
+		if i != index && !s.Players[i].IsOut {
+			s.Players[i].Points++
+		}
+	}
+
+	player := &s.Players[index]
+	if s.Rules.Lives == 0 || player.Lives == 0 {
+		return nil
+	}
+
+	player.Lives--
+	events := []Event{playerEvent(LifeLost, *player)}
+	if player.Lives == 0 {
+		events = append(events, playerEvent(PlayerEliminated, *player))
+	}
+	return events
+}
+
+// inMatch reports whether a player is dealt into the next round
+func (s State) inMatch(p Player) bool {
+	if p.Status == PlayerHasLeft {
+		return false
+	}
+	return s.Rules.Lives == 0 || p.Lives > 0
+}
+
+// isMatch reports whether the game has more than one round
+func (s State) isMatch() bool {
+	return s.Rules.Rounds > 1
+}
+
+// Standings ranks the players by lives when the rules give lives, then by
+// points, then by how long they lasted in the last round. Players that left
+// come last.
+func Standings(state State) []Standing {
+	lasted := make(map[string]int)
+	for i, playerId := range state.Eliminated {
+		lasted[playerId] = i + 1
+	}
+	for _, p := range state.Players {
+		if _, out := lasted[p.PlayerId]; !out {
+			lasted[p.PlayerId] = len(state.Players) + 1
+		}
+	}
+
+	players := append([]Player{}, state.Players...)
+	sort.SliceStable(players, func(i, j int) bool {
+		a, b := players[i], players[j]
+		if (a.Status == PlayerHasLeft) != (b.Status == PlayerHasLeft) {
+			return b.Status == PlayerHasLeft
+		}
+		if a.Lives != b.Lives {
+			return a.Lives > b.Lives
+		}
+		if a.Points != b.Points {
+			return a.Points > b.Points
+		}
+		return lasted[a.PlayerId] > lasted[b.PlayerId]
+	})
+
+	standings := []Standing{}
+	for i, p := range players {
+		standings = append(standings, Standing{
+			PlayerId:   p.PlayerId,
+			PlayerName: p.PlayerName,
+			Lives:      p.Lives,
+			Points:     p.Points,
+			Place:      i + 1,
+		})
+	}
+	return standings
+}
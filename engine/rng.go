@@ -0,0 +1,38 @@
+package engine
+
+// RNG is a small deterministic random generator (splitmix64). It is a plain
+// value inside State, so copying a state copies the generator with it and the
+// same seed and actions always give the same game.
+type RNG struct {
+	State uint64
+}
+
+func NewRNG(seed uint64) RNG {
+	return RNG{State: seed}
+}
+
+func (r *RNG) Uint64() uint64 {
+	r.State += 0x9e3779b97f4a7c15
+	z := r.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// Intn returns a number in [0, n), n must be positive
+func (r *RNG) Intn(n int) int {
+	// reject the top values that would make the modulo uneven
+	limit := ^uint64(0) - ^uint64(0)%uint64(n)
+	for {
+		if v := r.Uint64(); v < limit {
+			return int(v % uint64(n))
+		}
+	}
+}
+
+// Shuffle permutes n elements with swap, like rand.Shuffle
+func (r *RNG) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, r.Intn(i+1))
+	}
+}
@@ -0,0 +1,76 @@
+package engine
+
+// what a number card that brings the stack exactly to the target does
+const (
+	AtLimitAllowed   = "allowed"   // nothing, the stack may reach the target
+	AtLimitForbidden = "forbidden" // the card cannot be played, the stack stays below the target
+	AtLimitReset     = "reset"     // the stack goes back to 0
+)
+
+// what happens to a player whose turn times out
+const (
+	OnTimeoutPlay = "play" // their lowest card is played for them
+	OnTimeoutOut  = "out"  // they are out
+)
+
+// Rules are the settings a game is played with, they are fixed once it starts
+type Rules struct {
+	TargetValue   int   // the stack may not go over it
+	HandSize      int   // cards dealt to each player
+	Specials      []int // values of the special cards in the deck
+	NegativeCards bool  // whether negative number cards are in the deck
+	AtLimit       string
+	OnTimeout     string
+	Rounds        int // rounds in the match, the game ends after the last one
+	Lives         int // lives of each player, 0 when rounds only score points
+}
+
+var ClassicRules = Rules{
+	TargetValue:   99,
+	HandSize:      3,
+	Specials:      []int{SpecialPass, SpecialReverse, SpecialShuffle, SpecialMax},
+	NegativeCards: true,
+	AtLimit:       AtLimitAllowed,
+	OnTimeout:     OnTimeoutPlay,
+	Rounds:        1,
+}
+
+// SpecialCard returns the special card with the given name, like "reverse"
+func SpecialCard(name string) (Card, bool) {
+	for value, special := range specialNames {
+		if name == special {
+			return Card{Value: value, IsSpecial: true}, true
+		}
+	}
+	return Card{}, false
+}
+
+// SpecialName is the inverse of SpecialCard
+func SpecialName(card Card) string {
+	return specialNames[card.Value]
+}
+
+// allows reports whether the rules keep a card of the deck
+func (r Rules) allows(card Card) bool {
+	if !card.IsSpecial {
+		return card.Value >= 0 || r.NegativeCards
+	}
+
+	for _, value := range r.Specials {
+		if value == card.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the part of the deck the rules play with
+func (d Deck) filter(rules Rules) Deck {
+	filtered := Deck{}
+	for _, entry := range d {
+		if rules.allows(entry.Card) {
+			filtered = append(filtered, entry)
+		}
+	}
+	return filtered
+}
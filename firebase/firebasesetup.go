@@ -8,13 +8,21 @@ import (
 	"cloud.google.com/go/firestore"
 	fb "firebase.google.com/go"
 	"firebase.google.com/go/auth"
+	"firebase.google.com/go/storage"
 	"google.golang.org/api/option"
 )
 
 var FirestoreClient *firestore.Client
 var AuthClient *auth.Client
+var StorageClient *storage.Client
 
+// InitializeFirebase sets up the Firestore and Auth clients, it is safe to
+// call more than once
 func InitializeFirebase() {
+	if FirestoreClient != nil {
+		return
+	}
+
 	// Fetch the service account key JSON file path from environment variable or specify it directly
 	opt := option.WithCredentialsFile("serviceAccountKey.json")
 
@@ -34,5 +42,9 @@ func InitializeFirebase() {
 	if err != nil {
 		log.Fatalf("Error initializing Auth client: %v", err)
 	}
+	StorageClient, err = app.Storage(context.Background())
+	if err != nil {
+		log.Fatalf("Error initializing Storage client: %v", err)
+	}
 	fmt.Println("Firebase initialized successfully!")
 }
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	Auth "ninetynine/auth"
+	Avatar "ninetynine/avatar"
+	Room "ninetynine/room"
+)
+
+// passwordThrottled writes the response for a password check that has to wait,
+// it returns false for any other error
+func passwordThrottled(w http.ResponseWriter, err error) bool {
+	var tooMany *Auth.TooManyPasswordsError
+	if !errors.As(err, &tooMany) {
+		return false
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+	if tooMany.Locked {
+		requestErrorHandler(w, "Account is temporarily locked, check your email to unlock it", http.StatusTooManyRequests)
+		return true
+	}
+	requestErrorHandler(w, "Too many password attempts, try again later", http.StatusTooManyRequests)
+	return true
+}
+
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	newPassword, ok := data["newPassword"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if newPassword == "" {
+		requestErrorHandler(w, "Password cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	// accounts without a password confirm with a recent sign in instead
+	currentPassword, _ := data["currentPassword"].(string)
+	idToken, _ := data["idToken"].(string)
+	confirmation := Auth.Confirmation{SessionId: requestSessionId(r), Password: currentPassword, IdToken: idToken}
+
+	userData, err := Auth.ChangePassword(requestUserId(r), confirmation, newPassword)
+	if errors.Is(err, Auth.ErrGuest) {
+		requestErrorHandler(w, "Guests set a password through /guest/upgrade", http.StatusBadRequest)
+		return
+	}
+
+	if passwordThrottled(w, err) {
+		return
+	}
+
+	if errors.Is(err, Auth.ErrWrongPassword) {
+		requestErrorHandler(w, "Current password is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, Auth.ErrRecentSignIn) {
+		requestErrorHandler(w, "Sign in again to confirm", http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// every session was revoked, start a new one for this client
+	writeSession(w, r, userData)
+}
+
+func DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// accounts without a password confirm with a recent sign in instead
+	password, _ := data["password"].(string)
+	idToken, _ := data["idToken"].(string)
+	confirmation := Auth.Confirmation{SessionId: requestSessionId(r), Password: password, IdToken: idToken}
+
+	userId := requestUserId(r)
+	_, err = Auth.ConfirmUser(userId, confirmation)
+	if passwordThrottled(w, err) {
+		return
+	}
+
+	if errors.Is(err, Auth.ErrWrongPassword) {
+		requestErrorHandler(w, "Password is incorrect", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, Auth.ErrRecentSignIn) {
+		requestErrorHandler(w, "Sign in again to confirm", http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// scrub the user from rooms before the user document goes away
+	err = Room.RemoveUserFromRooms(userId)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = Avatar.Delete(userId)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = Auth.DeleteAccount(userId)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Account deleted"})
+	w.Write(responseJSON)
+}
+
+func ExportAccountHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow GET requests
+	if r.Method != http.MethodGet {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	export, err := Auth.ExportAccount(requestUserId(r))
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response as a downloadable archive
+	w.Header().Set("Content-Disposition", `attachment; filename="ninetynine-account.json"`)
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.MarshalIndent(export, "", "  ")
+	w.Write(responseJSON)
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -26,7 +27,7 @@ func AccountSettingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requiredFields := []string{"userId", "email", "username"}
+	requiredFields := []string{"email", "username"}
 	for _, field := range requiredFields {
 		if _, exists := data[field]; !exists {
 			requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
@@ -35,12 +36,29 @@ func AccountSettingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var accountData Auth.AccountData
-	accountData.UserId = data["userId"].(string)
+	accountData.UserId = requestUserId(r) // user comes from the access token
 	accountData.Email = data["email"].(string)
 	accountData.Username = data["username"].(string)
 
-	// authenticate user in firestore
+	// check if email is valid
+	if !Auth.IsValidEmail(accountData.Email) {
+		requestErrorHandler(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	// update user account
 	isValid, userData, err := Auth.AccountSetting(accountData)
+	if usernameErrorHandler(w, err) {
+		return
+	}
+	if errors.Is(err, Auth.ErrGuest) {
+		requestErrorHandler(w, "Guests add an email through /guest/upgrade", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, Auth.ErrEmailTaken) {
+		requestErrorHandler(w, "User with this email already exists", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		fmt.Println(err)
 		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	Auth "ninetynine/auth"
+	Store "ninetynine/store"
+)
+
+// adminError writes the errors shared by the admin endpoints, it returns
+// false if err is nil
+func adminError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, Store.ErrNotFound):
+		requestErrorHandler(w, "User not found", http.StatusNotFound)
+	case errors.Is(err, Auth.ErrOwnAccount):
+		requestErrorHandler(w, "You cannot change your own account", http.StatusBadRequest)
+	case errors.Is(err, Auth.ErrInvalidRole):
+		requestErrorHandler(w, "Invalid role", http.StatusBadRequest)
+	case errors.Is(err, Auth.ErrNoEmail):
+		requestErrorHandler(w, "User has no email address", http.StatusBadRequest)
+	default:
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// decodeAdminRequest reads the JSON body of an admin endpoint, every one of
+// them needs a userId except the lookup
+func decodeAdminRequest(w http.ResponseWriter, r *http.Request, requireUserId bool) (map[string]interface{}, bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if userId, _ := data["userId"].(string); requireUserId && userId == "" {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	return data, true
+}
+
+func writeAdminUser(w http.ResponseWriter, user Store.User) {
+	user.Role = Auth.UserRole(user)
+
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(user)
+	w.Write(responseJSON)
+}
+
+// AdminUserHandler looks a user up by userId, email or username
+func AdminUserHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeAdminRequest(w, r, false)
+	if !ok {
+		return
+	}
+
+	userId, _ := data["userId"].(string)
+	email, _ := data["email"].(string)
+	username, _ := data["username"].(string)
+	if userId == "" && email == "" && username == "" {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := Auth.FindUser(userId, email, username)
+	if adminError(w, err) {
+		return
+	}
+
+	writeAdminUser(w, user)
+}
+
+func AdminSetRoleHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeAdminRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	role, ok := data["role"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := Auth.SetRole(requestUserId(r), data["userId"].(string), role)
+	if adminError(w, err) {
+		return
+	}
+
+	writeAdminUser(w, user)
+}
+
+func AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeAdminRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	disabled, ok := data["disabled"].(bool)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := Auth.SetDisabled(requestUserId(r), data["userId"].(string), disabled)
+	if adminError(w, err) {
+		return
+	}
+
+	writeAdminUser(w, user)
+}
+
+func AdminResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeAdminRequest(w, r, true)
+	if !ok {
+		return
+	}
+
+	err := Auth.AdminResetPassword(data["userId"].(string))
+	if adminError(w, err) {
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Password reset email sent"})
+	w.Write(responseJSON)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	Auth "ninetynine/auth"
+)
+
+type contextKey string
+
+const (
+	userIdKey    contextKey = "userId"
+	sessionIdKey contextKey = "sessionId"
+)
+
+// AuthMiddleware requires a valid "Authorization: Bearer <accessToken>" header
+// and stores the authenticated user and session in the request context
+func AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accessToken, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !found || accessToken == "" {
+			w.Header().Set("Content-Type", "application/json")
+			requestErrorHandler(w, "Missing access token", http.StatusUnauthorized)
+			return
+		}
+
+		claims, err := Auth.VerifyAccessToken(accessToken)
+		if errors.Is(err, Auth.ErrInvalidToken) {
+			w.Header().Set("Content-Type", "application/json")
+			requestErrorHandler(w, "Invalid or expired access token", http.StatusUnauthorized)
+			return
+		}
+
+		if err != nil {
+			fmt.Println(err)
+			w.Header().Set("Content-Type", "application/json")
+			requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userIdKey, claims.Subject)
+		ctx = context.WithValue(ctx, sessionIdKey, claims.SessionId)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requestUserId returns the user authenticated by AuthMiddleware
+func requestUserId(r *http.Request) string {
+	userId, _ := r.Context().Value(userIdKey).(string)
+	return userId
+}
+
+// requestSessionId returns the session authenticated by AuthMiddleware
+func requestSessionId(r *http.Request) string {
+	sessionId, _ := r.Context().Value(sessionIdKey).(string)
+	return sessionId
+}
@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	Avatar "ninetynine/avatar"
+
+	"github.com/gorilla/mux"
+)
+
+// UploadAvatarHandler takes the image as the "avatar" field of a multipart form
+func UploadAvatarHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, Avatar.MaxUploadSize+64<<10)
+	file, _, err := r.FormFile("avatar")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		requestErrorHandler(w, "Image is too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, Avatar.MaxUploadSize+1))
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userData, err := Avatar.Upload(requestUserId(r), data)
+	switch {
+	case errors.Is(err, Avatar.ErrTooLarge):
+		requestErrorHandler(w, "Image is too large", http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, Avatar.ErrUnsupportedFormat):
+		requestErrorHandler(w, "Image must be a PNG, JPEG or WebP file", http.StatusBadRequest)
+		return
+	case errors.Is(err, Avatar.ErrBadDimensions):
+		requestErrorHandler(w, fmt.Sprintf("Image must be between %d and %d pixels on each side",
+			Avatar.MinDimension, Avatar.MaxDimension), http.StatusBadRequest)
+		return
+	case err != nil:
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(userData)
+	w.Write(responseJSON)
+}
+
+// DefaultAvatarHandler serves the generated avatar of any userId as png or
+// svg, the png size can be picked with the size query parameter
+func DefaultAvatarHandler(w http.ResponseWriter, r *http.Request) {
+
+	// only allow GET requests
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Content-Type", "application/json")
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userId := mux.Vars(r)["userId"]
+	format := mux.Vars(r)["format"]
+
+	var data []byte
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		data = Avatar.IdenticonSVG(userId)
+	} else {
+		size := Avatar.DefaultSize
+		if value := r.URL.Query().Get("size"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 16 || parsed > Avatar.MaxSize {
+				w.Header().Set("Content-Type", "application/json")
+				requestErrorHandler(w, fmt.Sprintf("size must be between 16 and %d", Avatar.MaxSize), http.StatusBadRequest)
+				return
+			}
+			size = parsed
+		}
+
+		var err error
+		data, err = Avatar.IdenticonPNG(userId, size)
+		if err != nil {
+			fmt.Println(err)
+			w.Header().Set("Content-Type", "application/json")
+			requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+	}
+
+	// the picture never changes for a userId
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustProxy makes clientIP use X-Forwarded-For, only enable it behind a
+// reverse proxy that sets the header
+var TrustProxy = false
+
+func clientIP(r *http.Request) string {
+	if TrustProxy {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -2,10 +2,12 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
-	Auth "ninetynine/auth"
 	Room "ninetynine/room"
+	Store "ninetynine/store"
 )
 
 func CreateroomHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,46 +20,117 @@ func CreateroomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check valid format
+	// the body is optional, without one the room plays the default rules
 	var data map[string]interface{}
 	err := json.NewDecoder(r.Body).Decode(&data)
-	if err != nil {
+	if err != nil && r.ContentLength > 0 {
 		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
 
-	requiredFields := []string{"userId"}
-	for _, field := range requiredFields {
-		if _, exists := data[field]; !exists {
-			requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
+	rules, ok := decodeRules(w, data)
+	if !ok {
+		return
 	}
 
-	// check userId
-	userId := data["userId"].(string)
-	isValid, err := Auth.IsValidUserId(userId)
+	// user comes from the access token
+	userId := requestUserId(r)
 
+	// create new room
+	newRoom, err := Room.CreateRoom(userId, rules)
 	if err != nil {
 		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	if !isValid {
-		requestErrorHandler(w, "Invalid user", http.StatusBadRequest)
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(newRoom)
+	w.Write(responseJSON)
+
+}
+
+// RoomRulesHandler lets the owner change the rules while the room is in the lobby
+func RoomRulesHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// check method
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// create new room
-	newRoom, err := Room.CreateRoom(userId)
+	// check valid format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	roomId, ok := data["roomId"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	rules, ok := decodeRules(w, data)
+	if !ok {
+		return
+	}
+
+	roomData, err, errMsg := Room.SetRules(requestUserId(r), roomId, rules)
 	if err != nil {
+		fmt.Println(err)
 		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
+	if errMsg != "" {
+		requestErrorHandler(w, errMsg, http.StatusBadRequest)
+		return
+	}
+
+	// players already in the lobby get the new rules right away
+	if pool, exists := runningPool(roomId); exists {
+		if err := pool.Game.SetRules(roomData.Rules); err != nil {
+			fmt.Println("Error updating game rules", err)
+		}
+	}
+
 	// write response
 	w.WriteHeader(http.StatusOK)
-	responseJSON, _ := json.Marshal(newRoom)
+	responseJSON, _ := json.Marshal(roomData)
 	w.Write(responseJSON)
+}
+
+// decodeRules reads "preset" and, for the "custom" preset, the "rules"
+// object. It writes the error response and returns false if they are invalid.
+func decodeRules(w http.ResponseWriter, data map[string]interface{}) (Store.RoomRules, bool) {
+	preset, _ := data["preset"].(string)
+
+	var custom Store.RoomRules
+	if rulesData, exists := data["rules"]; exists {
+		jsonData, _ := json.Marshal(rulesData)
+		if err := json.Unmarshal(jsonData, &custom); err != nil {
+			requestErrorHandler(w, "Invalid rules", http.StatusBadRequest)
+			return Store.RoomRules{}, false
+		}
+	}
+
+	rules, err := Room.ResolveRules(preset, custom)
+	var rulesErr *Room.RulesError
+	if errors.As(err, &rulesErr) {
+		requestErrorHandler(w, rulesErr.Message, http.StatusBadRequest)
+		return Store.RoomRules{}, false
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return Store.RoomRules{}, false
+	}
 
+	return rules, true
 }
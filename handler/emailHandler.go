@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	Auth "ninetynine/auth"
+	Store "ninetynine/store"
+)
+
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, ok := data["token"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	isValid, userData, err := Auth.VerifyEmail(token)
+	if errors.Is(err, Auth.ErrEmailTaken) {
+		requestErrorHandler(w, "User with this email already exists", http.StatusBadRequest)
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !isValid {
+		requestErrorHandler(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(userData)
+	w.Write(responseJSON)
+}
+
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData, err := Store.DB.GetUser(requestUserId(r))
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if userData.IsGuest {
+		requestErrorHandler(w, "Guests add an email through /guest/upgrade", http.StatusBadRequest)
+		return
+	}
+
+	if userData.EmailVerified && userData.PendingEmail == "" {
+		requestErrorHandler(w, "Email is already verified", http.StatusBadRequest)
+		return
+	}
+
+	err = Auth.SendVerificationEmail(userData)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Verification email sent"})
+	w.Write(responseJSON)
+}
+
+func UnlockAccountHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, ok := data["token"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	isValid, err := Auth.UnlockAccount(token)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !isValid {
+		requestErrorHandler(w, "Invalid or expired unlock token", http.StatusBadRequest)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Account unlocked"})
+	w.Write(responseJSON)
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	Auth "ninetynine/auth"
+)
+
+func FirebaseLoginHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	idToken, ok := data["idToken"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userData, err := Auth.FirebaseLogin(idToken)
+	if errors.Is(err, Auth.ErrFirebaseLoginDisabled) {
+		requestErrorHandler(w, "Firebase login is not enabled", http.StatusNotFound)
+		return
+	}
+
+	if errors.Is(err, Auth.ErrInvalidToken) {
+		requestErrorHandler(w, "Invalid Firebase ID token", http.StatusUnauthorized)
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// start a session, or ask for the second factor, and write response
+	writeLogin(w, r, userData)
+}
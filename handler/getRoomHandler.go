@@ -2,10 +2,11 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
-	Auth "ninetynine/auth"
 	Room "ninetynine/room"
+	Store "ninetynine/store"
 )
 
 func GetRoomHandler(w http.ResponseWriter, r *http.Request) {
@@ -27,7 +28,7 @@ func GetRoomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requiredFields := []string{"userId", "roomId"}
+	requiredFields := []string{"roomId"}
 	for _, field := range requiredFields {
 		if _, exists := data[field]; !exists {
 			requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
@@ -35,23 +36,14 @@ func GetRoomHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// check userId
-	userId := data["userId"].(string)
-	isValid, err := Auth.IsValidUserId(userId)
-
-	if err != nil {
-		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
+	roomId := data["roomId"].(string)
+	roomData, err := Room.GetRoom(roomId)
 
-	if !isValid {
-		requestErrorHandler(w, "Invalid user", http.StatusBadRequest)
+	if errors.Is(err, Store.ErrNotFound) {
+		requestErrorHandler(w, "Room does not exist", http.StatusBadRequest)
 		return
 	}
 
-	roomId := data["roomId"].(string)
-	roomData, err := Room.GetRoom(roomId)
-
 	if err != nil {
 		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
 		return
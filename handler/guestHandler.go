@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	Auth "ninetynine/auth"
+)
+
+func GuestHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userData, err := Auth.CreateGuest()
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// start a session and write response
+	writeSession(w, r, userData)
+}
+
+func UpgradeGuestHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	requiredFields := []string{"email", "password"}
+	for _, field := range requiredFields {
+		if _, ok := data[field].(string); !ok {
+			requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	email := data["email"].(string)
+	password := data["password"].(string)
+	username, _ := data["username"].(string) // optional, keeps the guest name when empty
+
+	// check if email is valid
+	if !Auth.IsValidEmail(email) {
+		requestErrorHandler(w, "Invalid email format", http.StatusBadRequest)
+		return
+	}
+
+	if password == "" {
+		requestErrorHandler(w, "Password cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	userData, err := Auth.UpgradeGuest(requestUserId(r), email, username, password)
+	if errors.Is(err, Auth.ErrNotGuest) {
+		requestErrorHandler(w, "User is not a guest", http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, Auth.ErrEmailTaken) {
+		requestErrorHandler(w, "User with this email already exists", http.StatusBadRequest)
+		return
+	}
+
+	if usernameErrorHandler(w, err) {
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(userData)
+	w.Write(responseJSON)
+}
@@ -2,7 +2,10 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+
+	Auth "ninetynine/auth"
 )
 
 func requestErrorHandler(w http.ResponseWriter, errMessage string, statusCode int) {
@@ -14,3 +17,32 @@ func requestErrorHandler(w http.ResponseWriter, errMessage string, statusCode in
 	w.WriteHeader(statusCode)
 	w.Write(responseJSON)
 }
+
+// requestErrorCodeHandler adds a machine readable code next to the message
+func requestErrorCodeHandler(w http.ResponseWriter, errMessage string, code string, statusCode int) {
+	responseData := map[string]interface{}{
+		"error": errMessage,
+		"code":  code,
+	}
+
+	responseJSON, _ := json.Marshal(responseData)
+	w.WriteHeader(statusCode)
+	w.Write(responseJSON)
+}
+
+// usernameErrorHandler writes username policy violations and taken
+// usernames, it returns false for any other error
+func usernameErrorHandler(w http.ResponseWriter, err error) bool {
+	var usernameErr *Auth.UsernameError
+	if errors.As(err, &usernameErr) {
+		requestErrorCodeHandler(w, usernameErr.Message, usernameErr.Code, http.StatusBadRequest)
+		return true
+	}
+
+	if errors.Is(err, Auth.ErrUsernameTaken) {
+		requestErrorCodeHandler(w, "User with this username already exists", Auth.UsernameTaken, http.StatusBadRequest)
+		return true
+	}
+
+	return false
+}
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"net/http"
 
-	Auth "ninetynine/auth"
 	Room "ninetynine/room"
 )
 
@@ -27,7 +26,7 @@ func JoinroomHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	requiredFields := []string{"userId", "roomId"}
+	requiredFields := []string{"roomId"}
 	for _, field := range requiredFields {
 		if _, exists := data[field]; !exists {
 			requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
@@ -35,19 +34,8 @@ func JoinroomHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// check userId
-	userId := data["userId"].(string)
-	isValid, err := Auth.IsValidUserId(userId)
-
-	if err != nil {
-		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
-		return
-	}
-
-	if !isValid {
-		requestErrorHandler(w, "Invalid user", http.StatusBadRequest)
-		return
-	}
+	// user comes from the access token
+	userId := requestUserId(r)
 
 	roomId := data["roomId"].(string)
 
@@ -3,9 +3,12 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 
 	Auth "ninetynine/auth"
+	Throttle "ninetynine/throttle"
 )
 
 type LoginData struct {
@@ -43,7 +46,26 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	loginData.Email = data["email"].(string)
 	loginData.Password = data["password"].(string)
 
-	// authenticate user in firestore
+	// check login throttling for this ip and account
+	ip := clientIP(r)
+	retryAfter, locked, err := Throttle.CheckLogin(ip, loginData.Email)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		if locked {
+			requestErrorHandler(w, "Account is temporarily locked, check your email to unlock it", http.StatusTooManyRequests)
+			return
+		}
+		requestErrorHandler(w, "Too many login attempts, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	// authenticate user
 	isValid, userData, err := Auth.Login(loginData.Email, loginData.Password)
 	if err != nil {
 		fmt.Println(err)
@@ -52,13 +74,28 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if !isValid {
+		lockedNow, err := Throttle.LoginFailed(ip, loginData.Email)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		if lockedNow {
+			err = Auth.SendUnlockEmail(loginData.Email)
+			if err != nil {
+				fmt.Println("Error sending unlock email", err)
+			}
+		}
+
 		requestErrorHandler(w, "email or password is incorrect", http.StatusBadRequest)
 		return
 	}
 
-	// write response
-	w.WriteHeader(http.StatusOK)
-	responseJSON, _ := json.Marshal(userData)
-	w.Write(responseJSON)
+	err = Throttle.LoginSucceeded(loginData.Email)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	// start a session, or ask for the second factor, and write response
+	writeLogin(w, r, userData)
 
 }
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	Auth "ninetynine/auth"
+	Throttle "ninetynine/throttle"
+)
+
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	email, ok := data["email"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// every request may send a mail, limit them per ip
+	ip := clientIP(r)
+	retryAfter, err := Throttle.CheckPasswordReset(ip)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		requestErrorHandler(w, "Too many reset requests, try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	err = Throttle.PasswordResetRequested(ip)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	err = Auth.RequestPasswordReset(email)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// same response whether or not the email exists
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"message": "If an account with this email exists, a reset link has been sent",
+	})
+	w.Write(responseJSON)
+}
+
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	token, tokenOk := data["token"].(string)
+	password, passwordOk := data["password"].(string)
+	if !tokenOk || !passwordOk {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if password == "" {
+		requestErrorHandler(w, "Password cannot be empty", http.StatusBadRequest)
+		return
+	}
+
+	isValid, err := Auth.ResetPassword(token, password)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !isValid {
+		requestErrorHandler(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Password has been reset"})
+	w.Write(responseJSON)
+}
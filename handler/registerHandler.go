@@ -2,10 +2,13 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
 	Auth "ninetynine/auth"
+	Store "ninetynine/store"
 )
 
 type RegisterData struct {
@@ -62,38 +65,56 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// check if username already exists in firestore
+	// check the username policy, the normalized name is the one stored
+	newUser.Username, err = Auth.CheckUsername(newUser.Username)
+	if usernameErrorHandler(w, err) {
+		return
+	}
+
+	// check if username already exists
 	isUniqueUsername, err := Auth.CheckUniqueUsername(newUser.Username)
 	if err != nil {
 		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 	if !isUniqueUsername {
-		requestErrorHandler(w, "User with this username already exists", http.StatusBadRequest)
+		usernameErrorHandler(w, Auth.ErrUsernameTaken)
 		return
 	}
 
-	// create user in firestore
-	userData := map[string]interface{}{
-		"username":  newUser.Username,
-		"email":     newUser.Email,
-		"createdAt": time.Now().Unix(), // Current timestamp (UNIX time)
-		"password":  newUser.Password,  // get hashed in Auth.CreateUser function
-		"gamestat": map[string]interface{}{
-			"playCount": 0,
+	// create user in store
+	userData := Store.User{
+		Username:  newUser.Username,
+		Email:     newUser.Email,
+		CreatedAt: time.Now().Unix(), // Current timestamp (UNIX time)
+		Password:  newUser.Password,  // get hashed in Auth.CreateUser function
+		GameStat: Store.GameStat{
+			PlayCount: 0,
 		},
-		"profilePic": "",
+		ProfilePic: "",
 	}
 
+	// the checks above give early answers, the store decides races between registrations
 	userData, err = Auth.CreateUser(userData)
+	if errors.Is(err, Auth.ErrEmailTaken) {
+		requestErrorHandler(w, "User with this email already exists", http.StatusBadRequest)
+		return
+	}
+	if usernameErrorHandler(w, err) {
+		return
+	}
 	if err != nil {
 		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	// write response
-	w.WriteHeader(http.StatusOK)
-	responseJSON, _ := json.Marshal(userData)
-	w.Write(responseJSON)
+	// the account works right away, the email is confirmed through the mailed link
+	err = Auth.SendVerificationEmail(userData)
+	if err != nil {
+		fmt.Println("Error sending verification email", err)
+	}
+
+	// start a session and write response
+	writeSession(w, r, userData)
 
 }
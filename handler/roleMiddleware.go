@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	Auth "ninetynine/auth"
+	Store "ninetynine/store"
+
+	"github.com/gorilla/mux"
+)
+
+// RequireRole only lets users with role, or a role above it, through. It
+// runs after AuthMiddleware and reads the role from the store on every
+// request so a demotion takes effect right away.
+func RequireRole(role string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, err := Store.DB.GetUser(requestUserId(r))
+			if errors.Is(err, Store.ErrNotFound) {
+				w.Header().Set("Content-Type", "application/json")
+				requestErrorHandler(w, "Invalid or expired access token", http.StatusUnauthorized)
+				return
+			}
+
+			if err != nil {
+				fmt.Println(err)
+				w.Header().Set("Content-Type", "application/json")
+				requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			if user.Disabled || !Auth.HasRole(user, role) {
+				w.Header().Set("Content-Type", "application/json")
+				requestErrorHandler(w, "Insufficient permissions", http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	Auth "ninetynine/auth"
+)
+
+func SessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow GET requests
+	if r.Method != http.MethodGet {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessions, err := Auth.ListSessions(requestUserId(r), requestSessionId(r))
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"sessions": sessions})
+	w.Write(responseJSON)
+}
+
+func RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	sessionId, ok := data["sessionId"].(string)
+	if !ok || sessionId == "" {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	err = Auth.RevokeUserSession(requestUserId(r), sessionId)
+	if errors.Is(err, Auth.ErrSessionNotFound) {
+		requestErrorHandler(w, "Session does not exist", http.StatusNotFound)
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Session revoked"})
+	w.Write(responseJSON)
+}
+
+// RevokeAllSessionsHandler signs out every other session, or every session
+// including this one with "includeCurrent"
+func RevokeAllSessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// the body is optional
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil && r.ContentLength > 0 {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	keepSessionId := requestSessionId(r)
+	if includeCurrent, _ := data["includeCurrent"].(bool); includeCurrent {
+		keepSessionId = ""
+	}
+
+	revoked, err := Auth.RevokeOtherSessions(requestUserId(r), keepSessionId)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Sessions revoked", "revoked": revoked})
+	w.Write(responseJSON)
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	Auth "ninetynine/auth"
+	Store "ninetynine/store"
+)
+
+// sessionResponse is returned by every endpoint that signs a user in
+type sessionResponse struct {
+	Store.User
+	Auth.Tokens
+}
+
+// writeSession starts a session for the user on the requesting device and
+// writes it as the response
+func writeSession(w http.ResponseWriter, r *http.Request, user Store.User) {
+	if user.Disabled {
+		requestErrorHandler(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	tokens, err := Auth.CreateSession(user.UserId, requestDevice(r))
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(sessionResponse{User: user, Tokens: tokens})
+	w.Write(responseJSON)
+}
+
+// writeLogin finishes a sign in with a password or Firebase. Accounts with
+// 2FA get a challenge for /login/2fa instead of a session.
+func writeLogin(w http.ResponseWriter, r *http.Request, user Store.User) {
+	if !user.TOTPEnabled || user.Disabled {
+		writeSession(w, r, user)
+		return
+	}
+
+	challenge, err := Auth.CreateTwoFactorChallenge(user.UserId)
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"twoFactorRequired": true,
+		"twoFactorToken":    challenge,
+	})
+	w.Write(responseJSON)
+}
+
+// requestDevice describes the client sending the request
+func requestDevice(r *http.Request) Auth.Device {
+	return Auth.Device{IP: clientIP(r), UserAgent: r.UserAgent()}
+}
+
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	refreshToken, ok := data["refreshToken"].(string)
+	if !ok {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := Auth.RefreshSession(refreshToken, requestDevice(r))
+	if errors.Is(err, Auth.ErrInvalidToken) {
+		requestErrorHandler(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	if errors.Is(err, Auth.ErrAccountDisabled) {
+		requestErrorHandler(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(tokens)
+	w.Write(responseJSON)
+}
+
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := Auth.RevokeSession(requestSessionId(r))
+	if err != nil {
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Logged out"})
+	w.Write(responseJSON)
+}
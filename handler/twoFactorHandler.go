@@ -0,0 +1,168 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	Auth "ninetynine/auth"
+)
+
+// twoFactorError writes the errors shared by the 2FA endpoints, it returns
+// false if err is nil
+func twoFactorError(w http.ResponseWriter, err error) bool {
+	var tooMany *Auth.TooManyCodesError
+	switch {
+	case err == nil:
+		return false
+	case passwordThrottled(w, err):
+	case errors.As(err, &tooMany):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+		requestErrorHandler(w, "Too many attempts, try again later", http.StatusTooManyRequests)
+	case errors.Is(err, Auth.ErrInvalidCode):
+		requestErrorHandler(w, "Invalid code", http.StatusBadRequest)
+	case errors.Is(err, Auth.ErrWrongPassword):
+		requestErrorHandler(w, "Password is incorrect", http.StatusBadRequest)
+	case errors.Is(err, Auth.ErrRecentSignIn):
+		requestErrorHandler(w, "Sign in again to confirm", http.StatusForbidden)
+	case errors.Is(err, Auth.ErrTwoFactorEnabled):
+		requestErrorHandler(w, "Two-factor authentication is already enabled", http.StatusBadRequest)
+	case errors.Is(err, Auth.ErrTwoFactorNotEnabled):
+		requestErrorHandler(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+	case errors.Is(err, Auth.ErrTwoFactorNotStarted):
+		requestErrorHandler(w, "Start the two-factor setup first", http.StatusBadRequest)
+	case errors.Is(err, Auth.ErrInvalidToken):
+		requestErrorHandler(w, "Invalid or expired two-factor token", http.StatusUnauthorized)
+	default:
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+	return true
+}
+
+// decodeTwoFactorRequest reads the string fields of the JSON body, fields
+// lists the ones that are required
+func decodeTwoFactorRequest(w http.ResponseWriter, r *http.Request, fields ...string) (map[string]string, bool) {
+	w.Header().Set("Content-Type", "application/json")
+
+	// only allow POST requests
+	if r.Method != http.MethodPost {
+		requestErrorHandler(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+
+	// check request body format
+	var data map[string]interface{}
+	err := json.NewDecoder(r.Body).Decode(&data)
+	if err != nil && len(fields) > 0 {
+		requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	values := map[string]string{}
+	for key, value := range data {
+		if text, ok := value.(string); ok {
+			values[key] = text
+		}
+	}
+
+	for _, field := range fields {
+		if _, ok := values[field]; !ok {
+			requestErrorHandler(w, "Invalid request body", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+
+	return values, true
+}
+
+func writeRecoveryCodes(w http.ResponseWriter, codes []string) {
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"recoveryCodes": codes})
+	w.Write(responseJSON)
+}
+
+// TwoFactorSetupHandler returns a new secret and its otpauth URI
+func TwoFactorSetupHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := decodeTwoFactorRequest(w, r); !ok {
+		return
+	}
+
+	setup, err := Auth.BeginTwoFactorSetup(requestUserId(r))
+	if twoFactorError(w, err) {
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(setup)
+	w.Write(responseJSON)
+}
+
+// TwoFactorConfirmHandler enables 2FA with a first code and returns the recovery codes
+func TwoFactorConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeTwoFactorRequest(w, r, "code")
+	if !ok {
+		return
+	}
+
+	codes, err := Auth.ConfirmTwoFactor(requestUserId(r), data["code"])
+	if twoFactorError(w, err) {
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+func TwoFactorDisableHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeTwoFactorRequest(w, r, "code")
+	if !ok {
+		return
+	}
+
+	// accounts without a password confirm with a recent sign in instead
+	confirmation := Auth.Confirmation{SessionId: requestSessionId(r), Password: data["password"], IdToken: data["idToken"]}
+	err := Auth.DisableTwoFactor(requestUserId(r), confirmation, data["code"])
+	if twoFactorError(w, err) {
+		return
+	}
+
+	// write response
+	w.WriteHeader(http.StatusOK)
+	responseJSON, _ := json.Marshal(map[string]interface{}{"message": "Two-factor authentication disabled"})
+	w.Write(responseJSON)
+}
+
+func RecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeTwoFactorRequest(w, r, "code")
+	if !ok {
+		return
+	}
+
+	codes, err := Auth.RegenerateRecoveryCodes(requestUserId(r), data["code"])
+	if twoFactorError(w, err) {
+		return
+	}
+
+	writeRecoveryCodes(w, codes)
+}
+
+// TwoFactorLoginHandler is the second login step, it takes the twoFactorToken
+// from /login and a TOTP or recovery code
+func TwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	data, ok := decodeTwoFactorRequest(w, r, "twoFactorToken", "code")
+	if !ok {
+		return
+	}
+
+	userData, err := Auth.VerifyTwoFactorLogin(data["twoFactorToken"], data["code"])
+	if twoFactorError(w, err) {
+		return
+	}
+
+	// start a session and write response
+	writeSession(w, r, userData)
+}
@@ -1,74 +1,147 @@
 package handler
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 
-	Firebase "ninetynine/firebase"
+	Auth "ninetynine/auth"
+	Avatar "ninetynine/avatar"
 	Room "ninetynine/room"
+	Store "ninetynine/store"
 	websocket "ninetynine/websocket"
 
 	"github.com/gorilla/mux"
-	"google.golang.org/api/iterator"
 )
 
-var Pools = make(map[string]*websocket.Pool)
+// pools holds the running pool of each room, handlers run concurrently so
+// every access goes through the functions below
+var pools = struct {
+	sync.Mutex
+	byRoom map[string]*websocket.Pool
+}{byRoom: make(map[string]*websocket.Pool)}
+
+// roomPool returns the pool of a room, starting one if none is running
+func roomPool(room Store.Room) *websocket.Pool {
+	pools.Lock()
+	defer pools.Unlock()
+
+	if pool, exists := pools.byRoom[room.RoomID]; exists {
+		return pool
+	}
+
+	fmt.Println("Creating new pool for room", room.RoomID)
+	pool := websocket.NewPool(room.RoomID, room.OwnerID, room.Rules)
+	pools.byRoom[room.RoomID] = pool
+	go func() {
+		pool.Start()
+		removePool(pool)
+	}()
+	return pool
+}
+
+// runningPool returns the pool of a room if one is running
+func runningPool(roomId string) (*websocket.Pool, bool) {
+	pools.Lock()
+	defer pools.Unlock()
+	pool, exists := pools.byRoom[roomId]
+	return pool, exists
+}
+
+// removePool forgets a pool that stopped, unless a new one replaced it
+func removePool(pool *websocket.Pool) {
+	pools.Lock()
+	defer pools.Unlock()
+	if pools.byRoom[pool.RoomId] == pool {
+		delete(pools.byRoom, pool.RoomId)
+		fmt.Println("Deleting room", pool.RoomId)
+	}
+}
 
 func WebsocketHandler(w http.ResponseWriter, r *http.Request) {
 	roomId := mux.Vars(r)["roomId"]
 
-	// check if room exist in firestore
-	docRef := Firebase.FirestoreClient.Collection("rooms").Doc(roomId)
-	_, err := docRef.Get(context.Background())
-	if err == iterator.Done {
-		fmt.Println("Room", roomId, "does not exist")
+	w.Header().Set("Content-Type", "application/json")
+
+	// authenticate before upgrading, the identity is bound to the connection
+	claims, err := Auth.VerifyAccessToken(websocket.AccessToken(r))
+	if errors.Is(err, Auth.ErrInvalidToken) {
+		requestErrorHandler(w, "Invalid or expired access token", http.StatusUnauthorized)
 		return
 	}
 
 	if err != nil {
-		fmt.Println("Error getting document", err)
+		fmt.Println(err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
-	docSnap, err := docRef.Get(context.Background())
+	user, err := Store.DB.GetUser(claims.Subject)
 	if err != nil {
-		fmt.Println("Error getting document", err)
+		fmt.Println("Error getting user", err)
+		requestErrorHandler(w, "Invalid user", http.StatusUnauthorized)
+		return
+	}
+
+	// check if room exist
+	roomData, err := Room.GetRoom(roomId)
+	if errors.Is(err, Store.ErrNotFound) {
+		fmt.Println("Room", roomId, "does not exist")
+		requestErrorHandler(w, "Room does not exist", http.StatusNotFound)
 		return
 	}
 
-	roomData := docSnap.Data()
+	if err != nil {
+		fmt.Println("Error getting document", err)
+		requestErrorHandler(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
 
-	if _, exist := Pools[roomId]; !exist {
-		fmt.Println("Creating new pool for room", roomId)
-		Pools[roomId] = websocket.NewPool(roomId, roomData["ownerId"].(string))
-		go Pools[roomId].Start()
+	// only users that joined the room through /joinroom may connect
+	isPlayer := contains(roomData.Players, user.UserId)
+	if !isPlayer && !contains(roomData.Spectators, user.UserId) {
+		requestErrorHandler(w, "User is not in room", http.StatusForbidden)
+		return
 	}
 
 	fmt.Println("WebSocket Endpoint Hit for room", roomId)
-	serveWs(Pools[roomId], w, r)
+	serveWs(roomData, user, claims.SessionId, !isPlayer, w, r)
 
 }
 
-func serveWs(pool *websocket.Pool, w http.ResponseWriter, r *http.Request) {
-	defer func() {
-		if len(pool.Clients) == 0 {
-			delete(Pools, pool.RoomId)
-			fmt.Println("Deleting room", pool.RoomId)
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
 		}
-	}()
+	}
+	return false
+}
+
+func serveWs(room Store.Room, user Store.User, sessionId string, isSpectator bool, w http.ResponseWriter, r *http.Request) {
 	conn, err := websocket.Upgrade(w, r)
 	if err != nil {
-		fmt.Fprintf(w, "%+v\n", err)
+		// Upgrade already replied with an http error
+		fmt.Println(err)
+		return
 	}
 
 	client := &websocket.Client{
-		Conn: conn,
-		Pool: pool,
+		ID:          user.UserId,
+		SessionId:   sessionId,
+		Name:        user.Username,
+		AvatarURL:   Avatar.URL(user),
+		IsSpectator: isSpectator,
+		Conn:        conn,
 	}
 
-	go Room.ManageRoom(pool.RoomId)
-
-	pool.Register <- client
+	// a pool may stop between the lookup and the join, a new one takes over
+	for {
+		client.Pool = roomPool(room)
+		if client.Pool.Join(client) {
+			break
+		}
+	}
 	client.Read()
 }
@@ -0,0 +1,38 @@
+package mail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogMailer writes emails to a file instead of sending them
+type LogMailer struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewLogMailer(path string) *LogMailer {
+	return &LogMailer{path: path}
+}
+
+func (m *LogMailer) Send(to string, subject string, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var out io.Writer = os.Stdout
+	if m.path != "" {
+		file, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+
+	_, err := fmt.Fprintf(out, "----- %s\nTo: %s\nSubject: %s\n\n%s\n\n",
+		time.Now().Format(time.RFC3339), to, subject, body)
+	return err
+}
@@ -0,0 +1,40 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+)
+
+// Mailer delivers plain text emails to users
+type Mailer interface {
+	Send(to string, subject string, body string) error
+}
+
+var Client Mailer
+
+// Initialize selects the mailer by name. "smtp" reads SMTP_HOST, SMTP_PORT,
+// SMTP_USERNAME, SMTP_PASSWORD and MAIL_FROM. "log" (the default) writes emails
+// to MAIL_LOG_FILE, or to stdout when it is empty, for local development.
+func Initialize(mailer string) error {
+	if mailer == "" {
+		mailer = "log"
+	}
+
+	switch mailer {
+	case "smtp":
+		Client = NewSMTPMailer(
+			os.Getenv("SMTP_HOST"),
+			os.Getenv("SMTP_PORT"),
+			os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"),
+			os.Getenv("MAIL_FROM"),
+		)
+	case "log":
+		Client = NewLogMailer(os.Getenv("MAIL_LOG_FILE"))
+	default:
+		return fmt.Errorf("unknown mailer %q", mailer)
+	}
+
+	fmt.Println("Using", mailer, "mailer")
+	return nil
+}
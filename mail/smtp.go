@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+type SMTPMailer struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTPMailer(host string, port string, username string, password string, from string) *SMTPMailer {
+	if port == "" {
+		port = "587"
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+
+	return &SMTPMailer{
+		addr: host + ":" + port,
+		auth: auth,
+		from: from,
+	}
+}
+
+func (m *SMTPMailer) Send(to string, subject string, body string) error {
+	// header values must not carry line breaks
+	if strings.ContainsAny(to+subject, "\r\n") {
+		return fmt.Errorf("invalid email header")
+	}
+
+	message := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, []byte(message))
+}
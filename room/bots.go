@@ -0,0 +1,69 @@
+package room
+
+import (
+	"errors"
+
+	Store "ninetynine/store"
+)
+
+// errBotSeatRejected aborts a bot seat update after the reason was recorded
+var errBotSeatRejected = errors.New("bot seat rejected")
+
+// AddBotSeat takes a seat of the room for a bot, only the owner may add bots
+// and only before the game starts
+func AddBotSeat(userId string, roomId string) (Room, error, string) {
+	errMsg := ""
+
+	roomData, err := Store.DB.UpdateRoom(roomId, func(roomData *Room) error {
+		if roomData.OwnerID != userId {
+			errMsg = "Only owner can add or remove bots"
+			return errBotSeatRejected
+		}
+
+		if roomData.Status != "waiting" && roomData.Status != "full" {
+			errMsg = "Room is not open"
+			return errBotSeatRejected
+		}
+
+		if len(roomData.Players)+roomData.BotSeats >= roomData.MaxCapacity {
+			errMsg = "Room is full"
+			return errBotSeatRejected
+		}
+
+		roomData.BotSeats++
+		if len(roomData.Players)+roomData.BotSeats >= roomData.MaxCapacity {
+			roomData.Status = "full"
+		}
+		return nil
+	})
+
+	if errors.Is(err, Store.ErrNotFound) {
+		return Room{}, nil, "Room does not exist"
+	}
+
+	if errors.Is(err, errBotSeatRejected) {
+		return Room{}, nil, errMsg
+	}
+
+	if err != nil {
+		return Room{}, err, "Error updating room"
+	}
+
+	return roomData, nil, ""
+}
+
+// RemoveBotSeats frees seats taken by bots, a full room opens again
+func RemoveBotSeats(roomId string, count int) error {
+	_, err := Store.DB.UpdateRoom(roomId, func(roomData *Room) error {
+		roomData.BotSeats -= count
+		if roomData.BotSeats < 0 {
+			roomData.BotSeats = 0
+		}
+
+		if roomData.Status == "full" && len(roomData.Players)+roomData.BotSeats < roomData.MaxCapacity {
+			roomData.Status = "waiting"
+		}
+		return nil
+	})
+	return err
+}
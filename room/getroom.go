@@ -1,19 +1,15 @@
 package room
 
 import (
-	"context"
-
-	Firebase "ninetynine/firebase"
+	Store "ninetynine/store"
 )
 
-func GetRoom(roomId string) (map[string]interface{}, error) {
-	docRef := Firebase.FirestoreClient.Collection("rooms").Doc(roomId)
-	docSnap, err := docRef.Get(context.Background())
+func GetRoom(roomId string) (Room, error) {
+	roomData, err := Store.DB.GetRoom(roomId)
 	if err != nil {
-		return nil, err
+		return Room{}, err
 	}
 
-	roomData := docSnap.Data()
-
+	roomData.Rules = roomRules(roomData.Rules)
 	return roomData, nil
 }
@@ -1,97 +1,91 @@
 package room
 
 import (
-	"context"
+	"errors"
 	"fmt"
-	Firebase "ninetynine/firebase"
+
+	Store "ninetynine/store"
 )
 
-type FirebaseUpdateData struct {
-	Field string
-	Value interface{}
+// UpdateStatus records the game status of a room, games run one goroutine
+// each so the store does the locking
+func UpdateStatus(roomId string, status string) {
+	_, err := Store.DB.UpdateRoom(roomId, func(roomData *Room) error {
+		roomData.Status = status
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error updating document", err)
+	}
 }
 
-var FirebaseUpdateChannel = make(map[string]chan FirebaseUpdateData)
-
-func ManageRoom(roomId string) {
-	defer func() {
-		delete(FirebaseUpdateChannel, roomId)
-	}()
-
-	FirebaseUpdateChannel[roomId] = make(chan FirebaseUpdateData)
-
-	for {
-		select {
-		case updateData := <-FirebaseUpdateChannel[roomId]:
-
-			docRef := Firebase.FirestoreClient.Collection("rooms").Doc(roomId)
-			docSnap, err := docRef.Get(context.Background())
-			if err != nil {
-				fmt.Println("Error getting document", err)
-				break
-			}
-
-			roomData := docSnap.Data()
-
-			roomData[updateData.Field] = updateData.Value
+func SaveMatch(match Store.Match) {
+	_, err := Store.DB.CreateMatch(match)
+	if err != nil {
+		fmt.Println("Error saving match", err)
+	}
+}
 
-			// update room in firestore
-			_, err = docRef.Set(context.Background(), roomData)
-			if err != nil {
-				fmt.Println("Error updating document", err)
+func PlayerLeft(roomId string, playerId string, isOwner bool) string {
+	roomData, err := Store.DB.UpdateRoom(roomId, func(roomData *Room) error {
+		// remove player from players array
+		for i, p := range roomData.Players {
+			if p == playerId {
+				roomData.Players = append(roomData.Players[:i], roomData.Players[i+1:]...)
 				break
 			}
-
-			// if game ended
-			if updateData.Field == "status" && updateData.Value == "ended" {
-				return
-			}
-
-			break
 		}
-	}
 
-}
-
-func PlayerLeft(roomId string, playerId string, isOwner bool) string {
-	docRef := Firebase.FirestoreClient.Collection("rooms").Doc(roomId)
-	docSnap, err := docRef.Get(context.Background())
+		if isOwner && len(roomData.Players) > 0 {
+			roomData.OwnerID = roomData.Players[0]
+		}
+		return nil
+	})
 	if err != nil {
-		fmt.Println("Error getting document", err)
+		fmt.Println("Error updating document", err)
 		return ""
 	}
 
-	roomData := docSnap.Data()
-	players := roomData["players"].([]interface{})
+	fmt.Println("players", roomData.Players)
 
-	// remove player from players array
-	for i, p := range players {
-		if p.(string) == playerId {
-			players = append(players[:i], players[i+1:]...)
-			break
-		}
+	if isOwner && len(roomData.Players) == 0 {
+		return ""
 	}
 
-	fmt.Println("players", players)
+	return roomData.OwnerID
+}
 
-	FirebaseUpdateChannel[roomId] <- FirebaseUpdateData{
-		Field: "players",
-		Value: players,
+// RemoveUserFromRooms drops a deleted user from every room they are listed
+// in, handing ownership to the next player where needed
+func RemoveUserFromRooms(userId string) error {
+	rooms, err := Store.DB.GetRoomsByMember(userId)
+	if err != nil {
+		return err
 	}
 
-	if isOwner {
-		if len(players) > 0 {
-			FirebaseUpdateChannel[roomId] <- FirebaseUpdateData{
-				Field: "ownerId",
-				Value: players[0].(string),
+	for _, r := range rooms {
+		_, err := Store.DB.UpdateRoom(r.RoomID, func(roomData *Room) error {
+			roomData.Players = removeString(roomData.Players, userId)
+			roomData.Spectators = removeString(roomData.Spectators, userId)
+
+			if roomData.OwnerID == userId && len(roomData.Players) > 0 {
+				roomData.OwnerID = roomData.Players[0]
 			}
-			return players[0].(string)
+			return nil
+		})
+		if err != nil && !errors.Is(err, Store.ErrNotFound) {
+			return err
 		}
-
-		return ""
-
-	} else {
-		return roomData["ownerId"].(string)
 	}
+	return nil
+}
 
+func removeString(list []string, value string) []string {
+	result := []string{}
+	for _, item := range list {
+		if item != value {
+			result = append(result, item)
+		}
+	}
+	return result
 }
@@ -1,123 +1,99 @@
 package room
 
 import (
-	"context"
+	"errors"
 	"fmt"
 	"math/rand"
-	Firebase "ninetynine/firebase"
-	"reflect"
 	"strconv"
 	"time"
 
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
+	Store "ninetynine/store"
 )
 
-type Room struct {
-	RoomID       string   `json:"roomId"`
-	CreatedAt    int64    `json:"createdAt"`
-	OwnerID      string   `json:"ownerId"`
-	MaxCapacity  int      `json:"maxCapacity"`
-	MaxSpectator int      `json:"maxSpectator"`
-	Status       string   `json:"status"`
-	Players      []string `json:"players"`
-	Spectators   []string `json:"spectators"`
-}
-
-func RoomToMap(room Room) (map[string]interface{}, error) {
-	roomMap := make(map[string]interface{})
+type Room = Store.Room
 
-	reflectValue := reflect.ValueOf(room)
-	reflectType := reflect.TypeOf(room)
+// errJoinRejected aborts a join transaction after JoinRoom recorded the reason
+var errJoinRejected = errors.New("join rejected")
 
-	for i := 0; i < reflectValue.NumField(); i++ {
-		field := reflectValue.Field(i)
-		fieldName := reflectType.Field(i).Tag.Get("json")
+// CreateRoom opens a room owned by the user, rules come from ResolveRules
+func CreateRoom(userId string, rules Store.RoomRules) (Room, error) {
+	for {
+		roomId := generateRoomId()
+
+		// create new room
+		newRoom := Room{
+			RoomID:       roomId,
+			CreatedAt:    time.Now().Unix(),
+			OwnerID:      userId,
+			MaxCapacity:  8,
+			MaxSpectator: 16,
+			Status:       "waiting",
+			Players:      []string{userId},
+			Spectators:   []string{},
+			Rules:        rules,
+		}
 
-		// Ignore fields with empty tag or unsupported types
-		if fieldName == "" || field.Kind() == reflect.Invalid {
+		err := Store.DB.CreateRoom(newRoom)
+		if errors.Is(err, Store.ErrAlreadyExists) {
+			// room id collision, try another one
 			continue
 		}
 
-		roomMap[fieldName] = field.Interface()
-	}
+		if err != nil {
+			fmt.Println(err)
+			return Room{}, err
+		}
 
-	return roomMap, nil
+		return newRoom, nil
+	}
 }
 
-func CreateRoom(userId string) (Room, error) {
-	roomId, err := generateRoomId()
-	if err != nil {
-		fmt.Println(err)
-		return Room{}, err
-	}
+func JoinRoom(userId string, roomId string) (Room, error, string) {
+	errMsg := ""
+
+	roomData, err := Store.DB.UpdateRoom(roomId, func(roomData *Room) error {
+		// check if user is already in room
+		for _, player := range roomData.Players {
+			if player == userId {
+				errMsg = "User is already in room"
+				return errJoinRejected
+			}
+		}
 
-	// create new room
-	newRoom := Room{
-		RoomID:       roomId,
-		CreatedAt:    time.Now().Unix(),
-		OwnerID:      userId,
-		MaxCapacity:  8,
-		MaxSpectator: 16,
-		Status:       "waiting",
-		Players:      []string{userId},
-		Spectators:   []string{},
-	}
+		// check if room is full, bots take seats too
+		playerCount := len(roomData.Players) + roomData.BotSeats
 
-	jsonData, _ := RoomToMap(newRoom)
-	fmt.Println(jsonData)
+		if playerCount >= roomData.MaxCapacity {
+			errMsg = "Room is full"
+			return errJoinRejected
+		}
 
-	_, err = Firebase.FirestoreClient.Collection("rooms").Doc(roomId).Set(context.Background(), jsonData)
-	if err != nil {
-		fmt.Println(err)
-		return Room{}, err
-	}
+		// check room status
+		if roomData.Status != "waiting" {
+			errMsg = "Room is not open"
+			return errJoinRejected
+		}
 
-	return newRoom, nil
+		// add player to room
+		roomData.Players = append(roomData.Players, userId)
 
-}
+		// if the room is full, change status to "full"
+		if playerCount+1 == roomData.MaxCapacity {
+			roomData.Status = "full"
+		}
 
-func JoinRoom(userId string, roomId string) (Room, error, string) {
-	// find room in firestore
-	roomData, err := findRoom(roomId)
-	if err != nil {
-		return Room{}, err, "Error finding room"
-	}
+		return nil
+	})
 
 	// check if room exists
-	if roomData.RoomID == "" {
+	if errors.Is(err, Store.ErrNotFound) {
 		return Room{}, nil, "Room does not exist"
 	}
 
-	// check if user is already in room
-	for _, player := range roomData.Players {
-		if player == userId {
-			return Room{}, nil, "User is already in room"
-		}
+	if errors.Is(err, errJoinRejected) {
+		return Room{}, nil, errMsg
 	}
 
-	// check if room is full
-	playerCount := len(roomData.Players)
-
-	if playerCount >= roomData.MaxCapacity {
-		return Room{}, nil, "Room is full"
-	}
-
-	// check room status
-	if roomData.Status != "waiting" {
-		return Room{}, nil, "Room is not open"
-	}
-
-	// add player to room
-	roomData.Players = append(roomData.Players, userId)
-
-	// if the room is full, change status to "full"
-	if playerCount+1 == roomData.MaxCapacity {
-		roomData.Status = "full"
-	}
-
-	// update room in firestore
-	_, err = updateRoom(roomId, roomData)
 	if err != nil {
 		return Room{}, err, "Error updating room"
 	}
@@ -125,81 +101,15 @@ func JoinRoom(userId string, roomId string) (Room, error, string) {
 	return roomData, nil, ""
 }
 
-func findRoom(roomId string) (Room, error) {
-	// find room in firestore
-	docRef := Firebase.FirestoreClient.Collection("rooms").Doc(roomId)
-	docSnap, err := docRef.Get(context.Background())
-	if status.Code(err) == codes.NotFound {
-		return Room{}, nil
-	}
-
-	if err != nil {
-		return Room{}, err
-	}
-
-	data := docSnap.Data()
+func generateRoomId() string {
+	// Generate a random 12-digit room ID
+	rand.NewSource(time.Now().UnixNano())
 
-	fmt.Println(data)
+	roomID := ""
 
-	roomData := Room{
-		RoomID:       roomId,
-		CreatedAt:    data["createdAt"].(int64),
-		OwnerID:      data["ownerId"].(string),
-		MaxCapacity:  int(data["maxCapacity"].(int64)),
-		MaxSpectator: int(data["maxSpectator"].(int64)),
-		Status:       data["status"].(string),
-		Players:      toStringSlice(data["players"].([]interface{})),
-		Spectators:   toStringSlice(data["spectators"].([]interface{})),
+	for i := 0; i < 12; i++ {
+		roomID += strconv.Itoa(rand.Intn(10))
 	}
 
-	fmt.Println(roomData)
-
-	return roomData, nil
-
-}
-
-// Helper function to convert []interface{} to []string
-func toStringSlice(slice []interface{}) []string {
-	result := make([]string, len(slice))
-	for i, v := range slice {
-		result[i] = v.(string)
-	}
-	return result
-}
-
-func updateRoom(roomId string, roomData Room) (Room, error) {
-	// update room in firestore
-
-	docRef := Firebase.FirestoreClient.Collection("rooms").Doc(roomId)
-	jsonData, _ := RoomToMap(roomData)
-	_, err := docRef.Set(context.Background(), jsonData)
-	if err != nil {
-		return Room{}, err
-	}
-
-	return roomData, nil
-}
-
-func generateRoomId() (string, error) {
-	for {
-		// Generate a random 12-digit room ID
-		rand.NewSource(time.Now().UnixNano())
-
-		roomID := ""
-
-		for i := 0; i < 12; i++ {
-			roomID += strconv.Itoa(rand.Intn(10))
-		}
-
-		// check if room exists
-		docRef := Firebase.FirestoreClient.Collection("rooms").Doc(roomID)
-		_, err := docRef.Get(context.Background())
-		if status.Code(err) == codes.NotFound {
-			return roomID, nil
-		}
-
-		if err != nil {
-			return "", err
-		}
-	}
+	return roomID
 }
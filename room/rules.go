@@ -0,0 +1,246 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+
+	Engine "ninetynine/engine"
+	Store "ninetynine/store"
+)
+
+const CustomPreset = "custom"
+
+// limits of custom rule sets
+const (
+	MinTargetValue = 10
+	MaxTargetValue = 999
+	MinHandSize    = 1
+	MaxHandSize    = 10
+	MinTurnSeconds = 5
+	MaxTurnSeconds = 300
+	MaxTimeBank    = 600
+	MaxRounds      = 20
+	MaxLives       = 10
+)
+
+// the specials of the original game
+var classicSpecials = []string{"pass", "reverse", "shuffle", "max"}
+
+var partySpecials = append(append([]string{}, classicSpecials...), "choose", "skip", "target")
+
+// Presets are the named rule sets owners can pick instead of "custom"
+var Presets = map[string]Store.RoomRules{
+	"classic": {
+		TargetValue: 99, HandSize: 3, Specials: classicSpecials,
+		NegativeCards: true, AtLimit: Engine.AtLimitAllowed,
+		TurnSeconds: 30, OnTimeout: Engine.OnTimeoutPlay, Rounds: 1,
+	},
+	// short games, the stack only goes up
+	"quick": {
+		TargetValue: 50, HandSize: 3, Specials: classicSpecials,
+		NegativeCards: false, AtLimit: Engine.AtLimitAllowed,
+		TurnSeconds: 15, OnTimeout: Engine.OnTimeoutPlay, Rounds: 1,
+	},
+	// no shuffles or jumps to the target, the target itself is off limits
+	// and running out of time puts the player out
+	"strict": {
+		TargetValue: 99, HandSize: 3, Specials: []string{"pass", "reverse"},
+		NegativeCards: true, AtLimit: Engine.AtLimitForbidden,
+		TurnSeconds: 30, OnTimeout: Engine.OnTimeoutOut, Rounds: 1,
+	},
+	// bigger hands, hitting the target exactly starts the stack over and
+	// every player has a time bank for long turns
+	"marathon": {
+		TargetValue: 99, HandSize: 5, Specials: classicSpecials,
+		NegativeCards: true, AtLimit: Engine.AtLimitReset,
+		TurnSeconds: 30, TimeBankSeconds: 120, OnTimeout: Engine.OnTimeoutPlay, Rounds: 1,
+	},
+	// every special, including choose, skip and target
+	"party": {
+		TargetValue: 99, HandSize: 4, Specials: partySpecials,
+		NegativeCards: true, AtLimit: Engine.AtLimitAllowed,
+		TurnSeconds: 30, OnTimeout: Engine.OnTimeoutPlay, Rounds: 1,
+	},
+	// the classic rules over up to 10 rounds, going out of a round costs one
+	// of 3 lives and a bot plays for players that drop out
+	"match": {
+		TargetValue: 99, HandSize: 3, Specials: classicSpecials,
+		NegativeCards: true, AtLimit: Engine.AtLimitAllowed,
+		TurnSeconds: 30, OnTimeout: Engine.OnTimeoutPlay, Rounds: 10, Lives: 3,
+		BotTakeover: true,
+	},
+}
+
+const DefaultPreset = "classic"
+
+// RulesError explains why a rule set was rejected
+type RulesError struct {
+	Message string
+}
+
+func (e *RulesError) Error() string {
+	return e.Message
+}
+
+// ResolveRules returns the rule set for a preset name, or validates custom
+// rules when preset is "custom". An empty preset is the default one.
+func ResolveRules(preset string, custom Store.RoomRules) (Store.RoomRules, error) {
+	if preset == "" {
+		preset = DefaultPreset
+	}
+
+	if preset != CustomPreset {
+		rules, exists := Presets[preset]
+		if !exists {
+			return Store.RoomRules{}, &RulesError{fmt.Sprintf("Unknown preset %q", preset)}
+		}
+		rules.Preset = preset
+		rules.Specials = append([]string{}, rules.Specials...)
+		return rules, nil
+	}
+
+	custom.Preset = CustomPreset
+	if custom.Rounds == 0 {
+		custom.Rounds = 1
+	}
+	if err := validateRules(custom); err != nil {
+		return Store.RoomRules{}, err
+	}
+
+	if custom.Specials == nil {
+		custom.Specials = []string{}
+	}
+	if custom.OnTimeout == "" {
+		custom.OnTimeout = Engine.OnTimeoutPlay
+	}
+	return custom, nil
+}
+
+func validateRules(rules Store.RoomRules) error {
+	if rules.TargetValue < MinTargetValue || rules.TargetValue > MaxTargetValue {
+		return &RulesError{fmt.Sprintf("Target value must be between %d and %d", MinTargetValue, MaxTargetValue)}
+	}
+
+	if rules.HandSize < MinHandSize || rules.HandSize > MaxHandSize {
+		return &RulesError{fmt.Sprintf("Hand size must be between %d and %d", MinHandSize, MaxHandSize)}
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range rules.Specials {
+		if _, ok := Engine.SpecialCard(name); !ok {
+			return &RulesError{fmt.Sprintf("Unknown special card %q", name)}
+		}
+		if seen[name] {
+			return &RulesError{fmt.Sprintf("Special card %q is listed twice", name)}
+		}
+		seen[name] = true
+	}
+
+	switch rules.AtLimit {
+	case Engine.AtLimitAllowed, Engine.AtLimitForbidden, Engine.AtLimitReset:
+	default:
+		return &RulesError{fmt.Sprintf("atLimit must be %q, %q or %q",
+			Engine.AtLimitAllowed, Engine.AtLimitForbidden, Engine.AtLimitReset)}
+	}
+
+	if rules.TurnSeconds != 0 && (rules.TurnSeconds < MinTurnSeconds || rules.TurnSeconds > MaxTurnSeconds) {
+		return &RulesError{fmt.Sprintf("Turn seconds must be 0 or between %d and %d", MinTurnSeconds, MaxTurnSeconds)}
+	}
+
+	if rules.TimeBankSeconds < 0 || rules.TimeBankSeconds > MaxTimeBank {
+		return &RulesError{fmt.Sprintf("Time bank must be between 0 and %d seconds", MaxTimeBank)}
+	}
+
+	if rules.Rounds < 1 || rules.Rounds > MaxRounds {
+		return &RulesError{fmt.Sprintf("Rounds must be between 1 and %d", MaxRounds)}
+	}
+
+	if rules.Lives < 0 || rules.Lives > MaxLives {
+		return &RulesError{fmt.Sprintf("Lives must be between 0 and %d", MaxLives)}
+	}
+
+	switch rules.OnTimeout {
+	case "", Engine.OnTimeoutPlay, Engine.OnTimeoutOut:
+	default:
+		return &RulesError{fmt.Sprintf("onTimeout must be %q or %q", Engine.OnTimeoutPlay, Engine.OnTimeoutOut)}
+	}
+
+	return nil
+}
+
+// roomRules fills in the default rules for rooms created before rule sets
+func roomRules(rules Store.RoomRules) Store.RoomRules {
+	if rules.Preset != "" {
+		return rules
+	}
+
+	defaults, _ := ResolveRules(DefaultPreset, Store.RoomRules{})
+	return defaults
+}
+
+// GameRules converts the rules of a room for the engine
+func GameRules(rules Store.RoomRules) Engine.Rules {
+	rules = roomRules(rules)
+
+	// rooms created before matches play a single round
+	rounds := rules.Rounds
+	if rounds < 1 {
+		rounds = 1
+	}
+
+	specials := []int{}
+	for _, name := range rules.Specials {
+		if card, ok := Engine.SpecialCard(name); ok {
+			specials = append(specials, card.Value)
+		}
+	}
+
+	return Engine.Rules{
+		TargetValue:   rules.TargetValue,
+		HandSize:      rules.HandSize,
+		Specials:      specials,
+		NegativeCards: rules.NegativeCards,
+		AtLimit:       rules.AtLimit,
+		OnTimeout:     rules.OnTimeout,
+		Rounds:        rounds,
+		Lives:         rules.Lives,
+	}
+}
+
+// errRulesRejected aborts a rules update after SetRules recorded the reason
+var errRulesRejected = errors.New("rules rejected")
+
+// SetRules changes the rules of a room that has not started playing, only
+// the owner may change them
+func SetRules(userId string, roomId string, rules Store.RoomRules) (Room, error, string) {
+	errMsg := ""
+
+	roomData, err := Store.DB.UpdateRoom(roomId, func(roomData *Room) error {
+		if roomData.OwnerID != userId {
+			errMsg = "Only owner can change the rules"
+			return errRulesRejected
+		}
+
+		if roomData.Status != "waiting" && roomData.Status != "full" {
+			errMsg = "Game has already started"
+			return errRulesRejected
+		}
+
+		roomData.Rules = rules
+		return nil
+	})
+
+	if errors.Is(err, Store.ErrNotFound) {
+		return Room{}, nil, "Room does not exist"
+	}
+
+	if errors.Is(err, errRulesRejected) {
+		return Room{}, nil, errMsg
+	}
+
+	if err != nil {
+		return Room{}, err, "Error updating room"
+	}
+
+	return roomData, nil, ""
+}
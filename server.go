@@ -5,9 +5,18 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"ninetynine/auth"
+	"ninetynine/avatar"
+	"ninetynine/blob"
+	"ninetynine/engine"
 	"ninetynine/firebase"
 	Handler "ninetynine/handler"
+	"ninetynine/mail"
+	"ninetynine/store"
+	"ninetynine/throttle"
+	"ninetynine/websocket"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -15,27 +24,90 @@ import (
 )
 
 func main() {
-	// firebase setup
-	firebase.InitializeFirebase()
+	// store setup, STORE selects the backend ("firestore", "memory", "sqlite" or "postgres")
+	err := store.Initialize(getEnv("STORE"), getEnv("DATABASE_URL"))
+	if err != nil {
+		log.Fatalf("Failed to initialize store: %v", err)
+	}
 
-	router := mux.NewRouter()
+	// access tokens are signed with JWT_SECRET
+	auth.SetTokenSecret(getEnv("JWT_SECRET"))
 
-	// request handlers
-	router.HandleFunc("/register", Handler.RegisterHandler)
-	router.HandleFunc("/login", Handler.LoginHandler)
-	router.HandleFunc("/createroom", Handler.CreateroomHandler)
-	router.HandleFunc("/joinroom", Handler.JoinroomHandler)
-	router.HandleFunc("/getroom", Handler.GetRoomHandler)
-	router.HandleFunc("/accountSetting", Handler.AccountSettingHandler)
+	// revoking a session closes the websockets opened with it
+	auth.OnSessionsRevoked(websocket.CloseSessions)
 
-	// websocket handlers
-	router.HandleFunc("/ws/{roomId}", Handler.WebsocketHandler)
+	// GAME_DECK overrides the card counts of the deck, e.g. "1:4,2:4,-10:2,pass:4"
+	if deck := getEnv("GAME_DECK"); deck != "" {
+		websocket.Deck, err = engine.ParseDeck(deck)
+		if err != nil {
+			log.Fatalf("Invalid GAME_DECK: %v", err)
+		}
+	}
+
+	// MAILER selects how emails are delivered ("log" or "smtp"), links in them point to APP_URL
+	err = mail.Initialize(getEnv("MAILER"))
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	auth.SetAppURL(getEnv("APP_URL"))
+
+	// FIREBASE_LOGIN=true enables /login/firebase, always on with the firestore store
+	if getEnv("FIREBASE_LOGIN") == "true" || getEnv("STORE") == "" || getEnv("STORE") == "firestore" {
+		firebase.InitializeFirebase()
+		auth.SetIDTokenVerifier(auth.NewFirebaseVerifier(firebase.AuthClient))
+	}
+
+	// USERNAME_* variables adjust the username policy
+	err = auth.LoadUsernamePolicy()
+	if err != nil {
+		log.Fatalf("Invalid username policy: %v", err)
+	}
+
+	// the accounts listed in ADMIN_EMAILS are made admins on startup
+	err = auth.PromoteAdmins(getEnv("ADMIN_EMAILS"))
+	if err != nil {
+		log.Fatalf("Failed to promote admins: %v", err)
+	}
+
+	// LOGIN_LIMITER selects where failed logins are counted ("memory" or "store" to share them across instances)
+	err = throttle.Initialize(getEnv("LOGIN_LIMITER"))
+	if err != nil {
+		log.Fatalf("Failed to initialize login limiter: %v", err)
+	}
+
+	// generated avatars and local uploads are linked under SERVER_URL
+	avatar.SetServerURL(getEnv("SERVER_URL"))
+
+	// BLOB_STORAGE selects where profile pictures are kept ("local" or "firebase")
+	err = blob.Initialize(getEnv("BLOB_STORAGE"))
+	if err != nil {
+		log.Fatalf("Failed to initialize blob storage: %v", err)
+	}
+
+	// TRUST_PROXY=true takes the client ip from X-Forwarded-For
+	Handler.TrustProxy = getEnv("TRUST_PROXY") == "true"
+
+	// guests that are not upgraded within GUEST_TTL (a duration like "168h") are deleted
+	guestTTL := 7 * 24 * time.Hour
+	if value := getEnv("GUEST_TTL"); value != "" {
+		guestTTL, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatalf("Invalid GUEST_TTL: %v", err)
+		}
+	}
+	auth.StartGuestCleanup(guestTTL)
+
+	router := newRouter()
 
 	// read PORT from .env file
 	port := ":" + getEnv("PORT")
 
-	// setup CORS
-	corsHandler := cors.Default()
+	// setup CORS, the Authorization header carries the access token
+	corsHandler := cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodHead},
+		AllowedHeaders: []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "Authorization"},
+	})
 	handler := corsHandler.Handler(router)
 
 	// Create a new HTTP server with default handler
@@ -46,12 +118,74 @@ func main() {
 
 	// Start the HTTP server
 	fmt.Printf("Server is running on https://localhost%s\n", port)
-	err := server.ListenAndServe()
+	err = server.ListenAndServe()
 	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
 
+func newRouter() *mux.Router {
+	router := mux.NewRouter()
+
+	// public request handlers
+	router.HandleFunc("/register", Handler.RegisterHandler)
+	router.HandleFunc("/login", Handler.LoginHandler)
+	router.HandleFunc("/login/firebase", Handler.FirebaseLoginHandler)
+	router.HandleFunc("/login/2fa", Handler.TwoFactorLoginHandler)
+	router.HandleFunc("/guest", Handler.GuestHandler)
+	router.HandleFunc("/token/refresh", Handler.RefreshTokenHandler)
+	router.HandleFunc("/password/forgot", Handler.ForgotPasswordHandler)
+	router.HandleFunc("/password/reset", Handler.ResetPasswordHandler)
+	router.HandleFunc("/email/verify", Handler.VerifyEmailHandler)
+	router.HandleFunc("/account/unlock", Handler.UnlockAccountHandler)
+	router.HandleFunc("/avatar/{userId:[^/.]+}.{format:png|svg}", Handler.DefaultAvatarHandler)
+
+	// request handlers that require an access token
+	authed := router.NewRoute().Subrouter()
+	authed.Use(Handler.AuthMiddleware)
+	authed.HandleFunc("/logout", Handler.LogoutHandler)
+	authed.HandleFunc("/sessions", Handler.SessionsHandler)
+	authed.HandleFunc("/sessions/revoke", Handler.RevokeSessionHandler)
+	authed.HandleFunc("/sessions/revoke-all", Handler.RevokeAllSessionsHandler)
+	authed.HandleFunc("/email/resend", Handler.ResendVerificationHandler)
+	authed.HandleFunc("/guest/upgrade", Handler.UpgradeGuestHandler)
+	authed.HandleFunc("/createroom", Handler.CreateroomHandler)
+	authed.HandleFunc("/joinroom", Handler.JoinroomHandler)
+	authed.HandleFunc("/room/rules", Handler.RoomRulesHandler)
+	authed.HandleFunc("/getroom", Handler.GetRoomHandler)
+	authed.HandleFunc("/accountSetting", Handler.AccountSettingHandler)
+	authed.HandleFunc("/account/password", Handler.ChangePasswordHandler)
+	authed.HandleFunc("/account/delete", Handler.DeleteAccountHandler)
+	authed.HandleFunc("/account/export", Handler.ExportAccountHandler)
+	authed.HandleFunc("/account/avatar", Handler.UploadAvatarHandler)
+	authed.HandleFunc("/2fa/setup", Handler.TwoFactorSetupHandler)
+	authed.HandleFunc("/2fa/confirm", Handler.TwoFactorConfirmHandler)
+	authed.HandleFunc("/2fa/disable", Handler.TwoFactorDisableHandler)
+	authed.HandleFunc("/2fa/recovery-codes", Handler.RecoveryCodesHandler)
+
+	// user lookup for moderators and admins
+	moderation := authed.NewRoute().Subrouter()
+	moderation.Use(Handler.RequireRole(auth.RoleModerator))
+	moderation.HandleFunc("/admin/user", Handler.AdminUserHandler)
+
+	// account management for admins only
+	admin := authed.NewRoute().Subrouter()
+	admin.Use(Handler.RequireRole(auth.RoleAdmin))
+	admin.HandleFunc("/admin/user/role", Handler.AdminSetRoleHandler)
+	admin.HandleFunc("/admin/user/disable", Handler.AdminDisableUserHandler)
+	admin.HandleFunc("/admin/user/password", Handler.AdminResetPasswordHandler)
+
+	// uploaded files when they are kept on the local disk
+	if local, ok := blob.Client.(*blob.LocalStorage); ok {
+		router.PathPrefix(blob.LocalPath).Handler(local.FileServer())
+	}
+
+	// websocket handlers
+	router.HandleFunc("/ws/{roomId}", Handler.WebsocketHandler)
+
+	return router
+}
+
 func getEnv(key string) string {
 	// load .env file
 	err := godotenv.Load(".env")
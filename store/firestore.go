@@ -0,0 +1,644 @@
+package store
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type FirestoreStore struct {
+	client *firestore.Client
+}
+
+func NewFirestoreStore(client *firestore.Client) *FirestoreStore {
+	return &FirestoreStore{client: client}
+}
+
+func (s *FirestoreStore) CreateUser(user User) (User, error) {
+	docRef := s.client.Collection("users").NewDoc()
+	user.UserId = docRef.ID
+
+	err := s.client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		err := s.checkReservations(tx, user.UserId, userReservations(user))
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(docRef, user)
+		if err != nil {
+			return err
+		}
+
+		return s.saveReservations(tx, user.UserId, userReservations(user), nil)
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *FirestoreStore) GetUser(userId string) (User, error) {
+	docSnap, err := s.client.Collection("users").Doc(userId).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return userFromSnapshot(docSnap)
+}
+
+func (s *FirestoreStore) GetUserByEmail(email string) (User, error) {
+	return s.findReserved(EmailKey(email))
+}
+
+func (s *FirestoreStore) GetUserByUsername(username string) (User, error) {
+	return s.findReserved(UsernameKey(username))
+}
+
+func (s *FirestoreStore) findReserved(key string) (User, error) {
+	docSnap, err := s.reservationRef(key).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	var doc reservationDoc
+	if err := docSnap.DataTo(&doc); err != nil {
+		return User{}, err
+	}
+
+	return s.GetUser(doc.UserId)
+}
+
+func (s *FirestoreStore) GetUserByFirebaseUid(firebaseUid string) (User, error) {
+	return s.findUser("firebaseUid", firebaseUid)
+}
+
+func (s *FirestoreStore) findUser(field string, value string) (User, error) {
+	query := s.client.Collection("users").Where(field, "==", value).Limit(1)
+	docSnap, err := query.Documents(context.Background()).Next()
+	if err == iterator.Done {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	return userFromSnapshot(docSnap)
+}
+
+func (s *FirestoreStore) UpdateUser(user User) error {
+	docRef := s.client.Collection("users").Doc(user.UserId)
+
+	return s.client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		old, err := userFromSnapshot(docSnap)
+		if err != nil {
+			return err
+		}
+
+		claim, release := reservationChanges(old, user)
+		err = s.checkReservations(tx, user.UserId, claim)
+		if err != nil {
+			return err
+		}
+
+		release, err = s.ownReservations(tx, user.UserId, release)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Set(docRef, user)
+		if err != nil {
+			return err
+		}
+
+		return s.saveReservations(tx, user.UserId, claim, release)
+	})
+}
+
+func (s *FirestoreStore) DeleteUser(userId string) error {
+	docRef := s.client.Collection("users").Doc(userId)
+
+	return s.client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		old, err := userFromSnapshot(docSnap)
+		if err != nil {
+			return err
+		}
+
+		_, release := reservationChanges(old, User{})
+		release, err = s.ownReservations(tx, userId, release)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(docRef)
+		if err != nil {
+			return err
+		}
+
+		return s.saveReservations(tx, userId, nil, release)
+	})
+}
+
+// reservations are kept as one document per key, the id is a hash of the
+// key since emails are not always valid document ids
+func (s *FirestoreStore) reservationRef(key string) *firestore.DocumentRef {
+	hashed := sha256.Sum256([]byte(key))
+	return s.client.Collection("reservations").Doc(hex.EncodeToString(hashed[:]))
+}
+
+type reservationDoc struct {
+	Key    string `firestore:"key"`
+	UserId string `firestore:"userId"`
+}
+
+// checkReservations reads the keys inside the transaction, which fails the
+// commit if another transaction claims one of them first
+func (s *FirestoreStore) checkReservations(tx *firestore.Transaction, userId string, claim []reservation) error {
+	for _, r := range claim {
+		docSnap, err := tx.Get(s.reservationRef(r.key))
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var doc reservationDoc
+		if err := docSnap.DataTo(&doc); err != nil {
+			return err
+		}
+		if doc.UserId != userId {
+			return r.err
+		}
+	}
+	return nil
+}
+
+// ownReservations filters keys down to the ones userId actually holds
+func (s *FirestoreStore) ownReservations(tx *firestore.Transaction, userId string, keys []string) ([]string, error) {
+	owned := []string{}
+	for _, key := range keys {
+		docSnap, err := tx.Get(s.reservationRef(key))
+		if status.Code(err) == codes.NotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var doc reservationDoc
+		if err := docSnap.DataTo(&doc); err != nil {
+			return nil, err
+		}
+		if doc.UserId == userId {
+			owned = append(owned, key)
+		}
+	}
+	return owned, nil
+}
+
+// saveReservations only writes, Firestore transactions do all reads first
+func (s *FirestoreStore) saveReservations(tx *firestore.Transaction, userId string, claim []reservation, release []string) error {
+	for _, key := range release {
+		if err := tx.Delete(s.reservationRef(key)); err != nil {
+			return err
+		}
+	}
+	for _, r := range claim {
+		if err := tx.Set(s.reservationRef(r.key), reservationDoc{Key: r.key, UserId: userId}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillReservations reserves the names of users created before
+// reservations existed. It runs once, a marker document records that it did.
+func (s *FirestoreStore) backfillReservations() error {
+	ctx := context.Background()
+	markerRef := s.client.Collection("meta").Doc("reservations")
+
+	_, err := markerRef.Get(ctx)
+	if err == nil {
+		return nil
+	}
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+
+	docSnaps, err := s.client.Collection("users").Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, docSnap := range docSnaps {
+		user, err := userFromSnapshot(docSnap)
+		if err != nil {
+			return err
+		}
+
+		// the first user keeps a name that only differs by case
+		for _, r := range userReservations(user) {
+			_, err := s.reservationRef(r.key).Create(ctx, reservationDoc{Key: r.key, UserId: user.UserId})
+			if err != nil && status.Code(err) != codes.AlreadyExists {
+				return err
+			}
+		}
+	}
+
+	_, err = markerRef.Set(ctx, map[string]interface{}{"backfilledAt": time.Now().Unix()})
+	return err
+}
+
+func (s *FirestoreStore) GetGuestsCreatedBefore(createdAt int64) ([]User, error) {
+	query := s.client.Collection("users").Where("isGuest", "==", true).Where("createdAt", "<", createdAt)
+	docSnaps, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	users := []User{}
+	for _, docSnap := range docSnaps {
+		user, err := userFromSnapshot(docSnap)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func userFromSnapshot(docSnap *firestore.DocumentSnapshot) (User, error) {
+	var user User
+	if err := docSnap.DataTo(&user); err != nil {
+		return User{}, err
+	}
+
+	user.UserId = docSnap.Ref.ID
+	return user, nil
+}
+
+func (s *FirestoreStore) CreateRoom(room Room) error {
+	_, err := s.client.Collection("rooms").Doc(room.RoomID).Create(context.Background(), room)
+	if status.Code(err) == codes.AlreadyExists {
+		return ErrAlreadyExists
+	}
+
+	return err
+}
+
+func (s *FirestoreStore) GetRoom(roomId string) (Room, error) {
+	docSnap, err := s.client.Collection("rooms").Doc(roomId).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return Room{}, ErrNotFound
+	}
+	if err != nil {
+		return Room{}, err
+	}
+
+	return roomFromSnapshot(docSnap)
+}
+
+func (s *FirestoreStore) UpdateRoom(roomId string, update func(room *Room) error) (Room, error) {
+	var updated Room
+	docRef := s.client.Collection("rooms").Doc(roomId)
+
+	err := s.client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		room, err := roomFromSnapshot(docSnap)
+		if err != nil {
+			return err
+		}
+
+		if err := update(&room); err != nil {
+			return err
+		}
+
+		updated = room
+		return tx.Set(docRef, room)
+	})
+	if err != nil {
+		return Room{}, err
+	}
+
+	return updated, nil
+}
+
+func (s *FirestoreStore) GetRoomsByMember(userId string) ([]Room, error) {
+	rooms := []Room{}
+	seen := map[string]bool{}
+
+	for _, field := range []string{"players", "spectators"} {
+		query := s.client.Collection("rooms").Where(field, "array-contains", userId)
+		docSnaps, err := query.Documents(context.Background()).GetAll()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, docSnap := range docSnaps {
+			if seen[docSnap.Ref.ID] {
+				continue
+			}
+			seen[docSnap.Ref.ID] = true
+
+			room, err := roomFromSnapshot(docSnap)
+			if err != nil {
+				return nil, err
+			}
+			rooms = append(rooms, room)
+		}
+	}
+	return rooms, nil
+}
+
+func roomFromSnapshot(docSnap *firestore.DocumentSnapshot) (Room, error) {
+	var room Room
+	if err := docSnap.DataTo(&room); err != nil {
+		return Room{}, err
+	}
+
+	room.RoomID = docSnap.Ref.ID
+	if room.Players == nil {
+		room.Players = []string{}
+	}
+	if room.Spectators == nil {
+		room.Spectators = []string{}
+	}
+	return room, nil
+}
+
+func (s *FirestoreStore) CreateMatch(match Match) (Match, error) {
+	docRef, _, err := s.client.Collection("matches").Add(context.Background(), match)
+	if err != nil {
+		return Match{}, err
+	}
+
+	match.MatchId = docRef.ID
+	return match, nil
+}
+
+func (s *FirestoreStore) GetMatchesByUser(userId string) ([]Match, error) {
+	query := s.client.Collection("matches").
+		Where("playerIds", "array-contains", userId).
+		OrderBy("endedAt", firestore.Desc)
+
+	docSnaps, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []Match{}
+	for _, docSnap := range docSnaps {
+		var match Match
+		if err := docSnap.DataTo(&match); err != nil {
+			return nil, err
+		}
+
+		match.MatchId = docSnap.Ref.ID
+		matches = append(matches, match)
+	}
+	return matches, nil
+}
+
+func (s *FirestoreStore) AnonymizeMatchPlayer(userId string, anonymousId string, anonymousName string) error {
+	query := s.client.Collection("matches").Where("playerIds", "array-contains", userId)
+	docSnaps, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, docSnap := range docSnaps {
+		var match Match
+		if err := docSnap.DataTo(&match); err != nil {
+			return err
+		}
+
+		match = anonymizeMatch(match, userId, anonymousId, anonymousName)
+		if _, err := docSnap.Ref.Set(context.Background(), match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FirestoreStore) CreateSession(session Session) (Session, error) {
+	docRef, _, err := s.client.Collection("sessions").Add(context.Background(), session)
+	if err != nil {
+		return Session{}, err
+	}
+
+	session.SessionId = docRef.ID
+	return session, nil
+}
+
+func (s *FirestoreStore) GetSession(sessionId string) (Session, error) {
+	docSnap, err := s.client.Collection("sessions").Doc(sessionId).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return Session{}, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	var session Session
+	if err := docSnap.DataTo(&session); err != nil {
+		return Session{}, err
+	}
+
+	session.SessionId = docSnap.Ref.ID
+	return session, nil
+}
+
+func (s *FirestoreStore) GetSessionsByUser(userId string) ([]Session, error) {
+	query := s.client.Collection("sessions").Where("userId", "==", userId)
+	docSnaps, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []Session{}
+	for _, docSnap := range docSnaps {
+		var session Session
+		if err := docSnap.DataTo(&session); err != nil {
+			return nil, err
+		}
+
+		session.SessionId = docSnap.Ref.ID
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt > sessions[j].CreatedAt })
+	return sessions, nil
+}
+
+func (s *FirestoreStore) UpdateSession(session Session) error {
+	_, err := s.client.Collection("sessions").Doc(session.SessionId).Set(context.Background(), session)
+	return err
+}
+
+func (s *FirestoreStore) TouchSession(sessionId string, lastSeenAt int64) error {
+	_, err := s.client.Collection("sessions").Doc(sessionId).Update(context.Background(),
+		[]firestore.Update{{Path: "lastSeenAt", Value: lastSeenAt}})
+	if status.Code(err) == codes.NotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *FirestoreStore) RevokeUserSessions(userId string) error {
+	query := s.client.Collection("sessions").Where("userId", "==", userId).Where("revoked", "==", false)
+	docSnaps, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, docSnap := range docSnaps {
+		_, err := docSnap.Ref.Update(context.Background(), []firestore.Update{{Path: "revoked", Value: true}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *FirestoreStore) CreateToken(token Token) error {
+	_, err := s.client.Collection("tokens").Doc(token.TokenHash).Set(context.Background(), token)
+	return err
+}
+
+func (s *FirestoreStore) ConsumeToken(tokenHash string, purpose string) (Token, error) {
+	var token Token
+	docRef := s.client.Collection("tokens").Doc(tokenHash)
+
+	err := s.client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		docSnap, err := tx.Get(docRef)
+		if status.Code(err) == codes.NotFound {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := docSnap.DataTo(&token); err != nil {
+			return err
+		}
+
+		if token.Purpose != purpose {
+			return ErrNotFound
+		}
+
+		return tx.Delete(docRef)
+	})
+	if err != nil {
+		return Token{}, err
+	}
+
+	token.TokenHash = tokenHash
+	return token, nil
+}
+
+func (s *FirestoreStore) DeleteUserTokens(userId string, purpose string) error {
+	query := s.client.Collection("tokens").Where("userId", "==", userId).Where("purpose", "==", purpose)
+	docSnaps, err := query.Documents(context.Background()).GetAll()
+	if err != nil {
+		return err
+	}
+
+	for _, docSnap := range docSnaps {
+		if _, err := docSnap.Ref.Delete(context.Background()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// login failures are kept as one document per key, the id is a hash of the
+// key since ips and emails are not always valid document ids
+func (s *FirestoreStore) loginFailuresRef(key string) *firestore.DocumentRef {
+	hashed := sha256.Sum256([]byte(key))
+	return s.client.Collection("loginFailures").Doc(hex.EncodeToString(hashed[:]))
+}
+
+type loginFailuresDoc struct {
+	Key      string  `firestore:"key"`
+	Failures []int64 `firestore:"failures"`
+}
+
+func (s *FirestoreStore) AddLoginFailure(key string, failedAt int64) error {
+	docRef := s.loginFailuresRef(key)
+
+	return s.client.RunTransaction(context.Background(), func(ctx context.Context, tx *firestore.Transaction) error {
+		doc := loginFailuresDoc{Key: key}
+
+		docSnap, err := tx.Get(docRef)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			if err := docSnap.DataTo(&doc); err != nil {
+				return err
+			}
+		}
+
+		doc.Failures = append(failuresSince(doc.Failures, failedAt-loginFailureRetention), failedAt)
+		return tx.Set(docRef, doc)
+	})
+}
+
+func (s *FirestoreStore) GetLoginFailures(key string, since int64) ([]int64, error) {
+	docSnap, err := s.loginFailuresRef(key).Get(context.Background())
+	if status.Code(err) == codes.NotFound {
+		return []int64{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc loginFailuresDoc
+	if err := docSnap.DataTo(&doc); err != nil {
+		return nil, err
+	}
+
+	return failuresSince(doc.Failures, since), nil
+}
+
+func (s *FirestoreStore) ClearLoginFailures(key string) error {
+	_, err := s.loginFailuresRef(key).Delete(context.Background())
+	return err
+}
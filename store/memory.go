@@ -0,0 +1,455 @@
+package store
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps every document in process memory. It is meant for local
+// development and tests; all data is lost when the server stops.
+type MemoryStore struct {
+	mu           sync.RWMutex
+	users        map[string]User
+	reservations map[string]string // reservation key -> userId
+	rooms        map[string]Room
+	matches      map[string]Match
+	sessions     map[string]Session
+	tokens       map[string]Token
+	failures     map[string][]int64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:        make(map[string]User),
+		reservations: make(map[string]string),
+		rooms:        make(map[string]Room),
+		matches:      make(map[string]Match),
+		sessions:     make(map[string]Session),
+		tokens:       make(map[string]Token),
+		failures:     make(map[string][]int64),
+	}
+}
+
+func (s *MemoryStore) CreateUser(user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		user.UserId = newId()
+		if _, exists := s.users[user.UserId]; !exists {
+			break
+		}
+	}
+
+	claim := userReservations(user)
+	if err := s.checkReservations(user.UserId, claim); err != nil {
+		return User{}, err
+	}
+
+	s.applyReservations(user.UserId, claim, nil)
+	s.users[user.UserId] = copyUser(user)
+	return user, nil
+}
+
+func (s *MemoryStore) GetUser(userId string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[userId]
+	if !exists {
+		return User{}, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (s *MemoryStore) GetUserByEmail(email string) (User, error) {
+	return s.findReserved(EmailKey(email))
+}
+
+func (s *MemoryStore) GetUserByUsername(username string) (User, error) {
+	return s.findReserved(UsernameKey(username))
+}
+
+func (s *MemoryStore) findReserved(key string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, exists := s.users[s.reservations[key]]
+	if !exists {
+		return User{}, ErrNotFound
+	}
+	return copyUser(user), nil
+}
+
+func (s *MemoryStore) GetUserByFirebaseUid(firebaseUid string) (User, error) {
+	return s.findUser(func(user User) bool { return user.FirebaseUid == firebaseUid })
+}
+
+func (s *MemoryStore) findUser(match func(user User) bool) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, user := range s.users {
+		if match(user) {
+			return copyUser(user), nil
+		}
+	}
+	return User{}, ErrNotFound
+}
+
+func (s *MemoryStore) UpdateUser(user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	old, exists := s.users[user.UserId]
+	if !exists {
+		return ErrNotFound
+	}
+
+	claim, release := reservationChanges(old, user)
+	if err := s.checkReservations(user.UserId, claim); err != nil {
+		return err
+	}
+
+	s.applyReservations(user.UserId, claim, release)
+	s.users[user.UserId] = copyUser(user)
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, release := reservationChanges(s.users[userId], User{})
+	s.applyReservations(userId, nil, release)
+	delete(s.users, userId)
+	return nil
+}
+
+// checkReservations fails if another user holds one of the keys, callers hold the lock
+func (s *MemoryStore) checkReservations(userId string, claim []reservation) error {
+	for _, r := range claim {
+		if owner, exists := s.reservations[r.key]; exists && owner != userId {
+			return r.err
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) applyReservations(userId string, claim []reservation, release []string) {
+	for _, key := range release {
+		if s.reservations[key] == userId {
+			delete(s.reservations, key)
+		}
+	}
+	for _, r := range claim {
+		s.reservations[r.key] = userId
+	}
+}
+
+func (s *MemoryStore) GetGuestsCreatedBefore(createdAt int64) ([]User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := []User{}
+	for _, user := range s.users {
+		if user.IsGuest && user.CreatedAt < createdAt {
+			users = append(users, copyUser(user))
+		}
+	}
+	return users, nil
+}
+
+func (s *MemoryStore) CreateRoom(room Room) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.rooms[room.RoomID]; exists {
+		return ErrAlreadyExists
+	}
+
+	s.rooms[room.RoomID] = copyRoom(room)
+	return nil
+}
+
+func (s *MemoryStore) GetRoom(roomId string) (Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	room, exists := s.rooms[roomId]
+	if !exists {
+		return Room{}, ErrNotFound
+	}
+	return copyRoom(room), nil
+}
+
+func (s *MemoryStore) UpdateRoom(roomId string, update func(room *Room) error) (Room, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.rooms[roomId]
+	if !exists {
+		return Room{}, ErrNotFound
+	}
+
+	room := copyRoom(current)
+	if err := update(&room); err != nil {
+		return Room{}, err
+	}
+
+	s.rooms[roomId] = copyRoom(room)
+	return room, nil
+}
+
+func (s *MemoryStore) CreateMatch(match Match) (Match, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	match.MatchId = newId()
+	s.matches[match.MatchId] = copyMatch(match)
+	return match, nil
+}
+
+func (s *MemoryStore) GetMatchesByUser(userId string) ([]Match, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	matches := []Match{}
+	for _, match := range s.matches {
+		for _, playerId := range match.PlayerIds {
+			if playerId == userId {
+				matches = append(matches, copyMatch(match))
+				break
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool { return matches[i].EndedAt > matches[j].EndedAt })
+	return matches, nil
+}
+
+func (s *MemoryStore) CreateSession(session Session) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session.SessionId = newId()
+	s.sessions[session.SessionId] = session
+	return session, nil
+}
+
+func (s *MemoryStore) GetSession(sessionId string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, exists := s.sessions[sessionId]
+	if !exists {
+		return Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *MemoryStore) UpdateSession(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.sessions[session.SessionId]; !exists {
+		return ErrNotFound
+	}
+
+	s.sessions[session.SessionId] = session
+	return nil
+}
+
+func (s *MemoryStore) TouchSession(sessionId string, lastSeenAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, exists := s.sessions[sessionId]
+	if !exists {
+		return ErrNotFound
+	}
+
+	session.LastSeenAt = lastSeenAt
+	s.sessions[sessionId] = session
+	return nil
+}
+
+func (s *MemoryStore) RevokeUserSessions(userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for sessionId, session := range s.sessions {
+		if session.UserId == userId {
+			session.Revoked = true
+			s.sessions[sessionId] = session
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) CreateToken(token Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token.TokenHash] = token
+	return nil
+}
+
+func (s *MemoryStore) ConsumeToken(tokenHash string, purpose string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, exists := s.tokens[tokenHash]
+	if !exists || token.Purpose != purpose {
+		return Token{}, ErrNotFound
+	}
+
+	delete(s.tokens, tokenHash)
+	return token, nil
+}
+
+func (s *MemoryStore) DeleteUserTokens(userId string, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for tokenHash, token := range s.tokens {
+		if token.UserId == userId && token.Purpose == purpose {
+			delete(s.tokens, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) AddLoginFailure(key string, failedAt int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[key] = append(failuresSince(s.failures[key], failedAt-loginFailureRetention), failedAt)
+	return nil
+}
+
+func (s *MemoryStore) GetLoginFailures(key string, since int64) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return failuresSince(s.failures[key], since), nil
+}
+
+func (s *MemoryStore) ClearLoginFailures(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+func failuresSince(failures []int64, since int64) []int64 {
+	recent := []int64{}
+	for _, failedAt := range failures {
+		if failedAt >= since {
+			recent = append(recent, failedAt)
+		}
+	}
+	return recent
+}
+
+func (s *MemoryStore) GetRoomsByMember(userId string) ([]Room, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rooms := []Room{}
+	for _, room := range s.rooms {
+		if containsString(room.Players, userId) || containsString(room.Spectators, userId) {
+			rooms = append(rooms, copyRoom(room))
+		}
+	}
+	return rooms, nil
+}
+
+func (s *MemoryStore) AnonymizeMatchPlayer(userId string, anonymousId string, anonymousName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for matchId, match := range s.matches {
+		if !containsString(match.PlayerIds, userId) {
+			continue
+		}
+
+		s.matches[matchId] = anonymizeMatch(copyMatch(match), userId, anonymousId, anonymousName)
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetSessionsByUser(userId string) ([]Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sessions := []Session{}
+	for _, session := range s.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt > sessions[j].CreatedAt })
+	return sessions, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// anonymizeMatch swaps userId for the anonymous player in a copied match
+func anonymizeMatch(match Match, userId string, anonymousId string, anonymousName string) Match {
+	if match.WinnerId == userId {
+		match.WinnerId = anonymousId
+	}
+
+	for i, playerId := range match.PlayerIds {
+		if playerId == userId {
+			match.PlayerIds[i] = anonymousId
+		}
+	}
+
+	for i, p := range match.Players {
+		if p.PlayerId == userId {
+			match.Players[i].PlayerId = anonymousId
+			match.Players[i].PlayerName = anonymousName
+		}
+	}
+	return match
+}
+
+// copyUser makes sure callers never share the recovery codes with the stored user
+func copyUser(user User) User {
+	user.RecoveryCodes = append(StringList{}, user.RecoveryCodes...)
+	return user
+}
+
+// copyRoom makes sure callers never share slices with the stored document
+func copyRoom(room Room) Room {
+	room.Players = append([]string{}, room.Players...)
+	room.Spectators = append([]string{}, room.Spectators...)
+	room.Rules.Specials = append([]string{}, room.Rules.Specials...)
+	return room
+}
+
+func copyMatch(match Match) Match {
+	match.PlayerIds = append([]string{}, match.PlayerIds...)
+	match.Players = append([]MatchPlayer{}, match.Players...)
+	return match
+}
+
+// newId generates a random 20 character id, the same length Firestore uses
+func newId() string {
+	b := make([]byte, 10)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
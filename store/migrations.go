@@ -0,0 +1,228 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations are applied in order at boot. Never edit a migration that has
+// shipped, append a new one instead.
+var migrations = [][]string{
+	// 1: users, rooms and match history
+	{
+		`CREATE TABLE users (
+			id          TEXT PRIMARY KEY,
+			username    TEXT NOT NULL,
+			email       TEXT NOT NULL,
+			password    TEXT NOT NULL,
+			created_at  BIGINT NOT NULL,
+			play_count  INTEGER NOT NULL DEFAULT 0,
+			profile_pic TEXT NOT NULL DEFAULT ''
+		)`,
+		`CREATE INDEX users_email ON users (email)`,
+		`CREATE INDEX users_username ON users (username)`,
+		`CREATE TABLE rooms (
+			id            TEXT PRIMARY KEY,
+			created_at    BIGINT NOT NULL,
+			owner_id      TEXT NOT NULL,
+			max_capacity  INTEGER NOT NULL,
+			max_spectator INTEGER NOT NULL,
+			status        TEXT NOT NULL
+		)`,
+		`CREATE TABLE room_members (
+			room_id  TEXT NOT NULL REFERENCES rooms (id) ON DELETE CASCADE,
+			user_id  TEXT NOT NULL,
+			role     TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			PRIMARY KEY (room_id, role, position)
+		)`,
+		`CREATE TABLE matches (
+			id         TEXT PRIMARY KEY,
+			room_id    TEXT NOT NULL,
+			started_at BIGINT NOT NULL,
+			ended_at   BIGINT NOT NULL,
+			winner_id  TEXT NOT NULL
+		)`,
+		`CREATE TABLE match_players (
+			match_id    TEXT NOT NULL REFERENCES matches (id) ON DELETE CASCADE,
+			user_id     TEXT NOT NULL,
+			player_name TEXT NOT NULL,
+			placement   INTEGER NOT NULL,
+			PRIMARY KEY (match_id, user_id)
+		)`,
+		`CREATE INDEX match_players_user ON match_players (user_id)`,
+	},
+	// 2: login sessions
+	{
+		`CREATE TABLE sessions (
+			id                 TEXT PRIMARY KEY,
+			user_id            TEXT NOT NULL,
+			refresh_token_hash TEXT NOT NULL,
+			created_at         BIGINT NOT NULL,
+			expires_at         BIGINT NOT NULL,
+			revoked            BOOLEAN NOT NULL DEFAULT FALSE
+		)`,
+		`CREATE INDEX sessions_user ON sessions (user_id)`,
+	},
+	// 3: single use tokens (password reset, ...)
+	{
+		`CREATE TABLE tokens (
+			hash       TEXT PRIMARY KEY,
+			user_id    TEXT NOT NULL,
+			purpose    TEXT NOT NULL,
+			data       TEXT NOT NULL DEFAULT '',
+			created_at BIGINT NOT NULL,
+			expires_at BIGINT NOT NULL
+		)`,
+		`CREATE INDEX tokens_user ON tokens (user_id, purpose)`,
+	},
+	// 4: email verification
+	{
+		`ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN pending_email TEXT NOT NULL DEFAULT ''`,
+	},
+	// 5: accounts linked to Firebase Auth
+	{
+		`ALTER TABLE users ADD COLUMN firebase_uid TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX users_firebase_uid ON users (firebase_uid)`,
+	},
+	// 6: guest accounts
+	{
+		`ALTER TABLE users ADD COLUMN is_guest BOOLEAN NOT NULL DEFAULT FALSE`,
+		`CREATE INDEX users_guest ON users (is_guest, created_at)`,
+	},
+	// 7: failed logins for the shared login limiter
+	{
+		`CREATE TABLE login_failures (
+			limiter_key TEXT NOT NULL,
+			failed_at   BIGINT NOT NULL
+		)`,
+		`CREATE INDEX login_failures_key ON login_failures (limiter_key, failed_at)`,
+	},
+	// 8: case-insensitive username and email reservations
+	{
+		`CREATE TABLE reservations (
+			reservation_key TEXT PRIMARY KEY,
+			user_id         TEXT NOT NULL
+		)`,
+	},
+	// 9: roles and disabled accounts
+	{
+		`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'player'`,
+		`ALTER TABLE users ADD COLUMN disabled BOOLEAN NOT NULL DEFAULT FALSE`,
+	},
+	// 10: two-factor authentication
+	{
+		`ALTER TABLE users ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE`,
+		`ALTER TABLE users ADD COLUMN totp_secret TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE users ADD COLUMN totp_last_step BIGINT NOT NULL DEFAULT 0`,
+		`ALTER TABLE users ADD COLUMN recovery_codes TEXT NOT NULL DEFAULT ''`,
+	},
+	// 11: session devices
+	{
+		`ALTER TABLE sessions ADD COLUMN device_label TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE sessions ADD COLUMN ip TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE sessions ADD COLUMN last_seen_at BIGINT NOT NULL DEFAULT 0`,
+		`UPDATE sessions SET last_seen_at = created_at`,
+	},
+	// 12: room rule sets
+	{
+		`ALTER TABLE rooms ADD COLUMN rules TEXT NOT NULL DEFAULT ''`,
+	},
+	// 13: bots
+	{
+		`ALTER TABLE rooms ADD COLUMN bot_seats INTEGER NOT NULL DEFAULT 0`,
+		`ALTER TABLE match_players ADD COLUMN is_bot BOOLEAN NOT NULL DEFAULT FALSE`,
+	},
+}
+
+// migrationSteps run in Go after the statements of the migration with the
+// same number, for changes SQL cannot express
+var migrationSteps = map[int]func(s *SQLStore, tx *sql.Tx) error{
+	8: (*SQLStore).backfillReservations,
+}
+
+func (s *SQLStore) migrate() error {
+	return s.migrateTo(len(migrations))
+}
+
+// migrateTo applies the migrations up to and including target
+func (s *SQLStore) migrateTo(target int) error {
+	_, err := s.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	err = s.db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return err
+	}
+
+	for i := current; i < target; i++ {
+		version := i + 1
+
+		err := s.inTx(func(tx *sql.Tx) error {
+			for _, statement := range migrations[i] {
+				if _, err := tx.Exec(statement); err != nil {
+					return err
+				}
+			}
+
+			if step, exists := migrationSteps[version]; exists {
+				if err := step(s, tx); err != nil {
+					return err
+				}
+			}
+
+			_, err := tx.Exec(s.rebind(`INSERT INTO schema_migrations (version) VALUES (?)`), version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+
+		fmt.Println("Applied migration", version)
+	}
+
+	return nil
+}
+
+// backfillReservations reserves the names of users created before
+// reservations existed, with the same keys the store checks them by. Only
+// columns that existed at migration 8 are read.
+func (s *SQLStore) backfillReservations(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, username, email FROM users ORDER BY created_at, id`)
+	if err != nil {
+		return err
+	}
+
+	// read everything first, sqlite runs the transaction on a single connection
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.UserId, &user.Username, &user.Email); err != nil {
+			rows.Close()
+			return err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, user := range users {
+		// the first user keeps a name that only differs by case
+		for _, r := range userReservations(user) {
+			_, err := tx.Exec(s.rebind(`INSERT INTO reservations (reservation_key, user_id) VALUES (?, ?)
+				ON CONFLICT DO NOTHING`), r.key, user.UserId)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Usernames and emails are unique regardless of case. Every backend keeps one
+// reservation per normalized key, claimed and released in the same
+// transaction that writes the user, so concurrent writes cannot both win.
+
+var (
+	ErrUsernameTaken = errors.New("username already in use")
+	ErrEmailTaken    = errors.New("email already in use")
+)
+
+// UsernameKey is the reservation key of a username, compatibility forms and
+// case are folded so "Alice", "ALICE" and "Ａｌｉｃｅ" collide
+func UsernameKey(username string) string {
+	return "username:" + cases.Fold().String(norm.NFKC.String(strings.TrimSpace(username)))
+}
+
+// EmailKey is the reservation key of an email address
+func EmailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+type reservation struct {
+	key string
+	err error // returned when another user holds the key
+}
+
+// userReservations lists the keys a user holds, empty values hold none
+func userReservations(user User) []reservation {
+	reservations := []reservation{}
+	if user.Username != "" {
+		reservations = append(reservations, reservation{UsernameKey(user.Username), ErrUsernameTaken})
+	}
+	if user.Email != "" {
+		reservations = append(reservations, reservation{EmailKey(user.Email), ErrEmailTaken})
+	}
+	return reservations
+}
+
+// reservationChanges compares the stored user with its update and returns
+// the keys to claim and the keys to release
+func reservationChanges(old User, user User) ([]reservation, []string) {
+	held := map[string]bool{}
+	for _, r := range userReservations(old) {
+		held[r.key] = true
+	}
+
+	claim := []reservation{}
+	for _, r := range userReservations(user) {
+		if held[r.key] {
+			delete(held, r.key)
+			continue
+		}
+		claim = append(claim, r)
+	}
+
+	release := []string{}
+	for key := range held {
+		release = append(release, key)
+	}
+	return claim, release
+}
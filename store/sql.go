@@ -0,0 +1,738 @@
+package store
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// SQLStore keeps users, rooms and match history in SQLite or Postgres.
+// Queries are written with "?" placeholders and rebound for Postgres.
+type SQLStore struct {
+	db      *sql.DB
+	dialect string
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func NewSQLStore(dialect string, databaseURL string) (*SQLStore, error) {
+	var driver string
+	switch dialect {
+	case "sqlite":
+		driver = "sqlite"
+		if databaseURL == "" {
+			databaseURL = "ninetynine.db"
+		}
+	case "postgres":
+		driver = "postgres"
+	default:
+		return nil, fmt.Errorf("unknown sql dialect %q", dialect)
+	}
+
+	db, err := sql.Open(driver, databaseURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// sqlite only allows a single writer, serialize everything through one connection
+	if dialect == "sqlite" {
+		db.SetMaxOpenConns(1)
+	}
+
+	s := &SQLStore{db: db, dialect: dialect}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *SQLStore) rebind(query string) string {
+	if s.dialect != "postgres" {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			builder.WriteString(fmt.Sprintf("$%d", n))
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+func (s *SQLStore) inTx(f func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// userColumns and userFields must list the same columns in the same order, id first
+var userColumns = []string{
+	"id", "username", "email", "password", "created_at", "play_count", "profile_pic",
+	"email_verified", "pending_email", "firebase_uid", "is_guest", "role", "disabled",
+	"totp_enabled", "totp_secret", "totp_last_step", "recovery_codes",
+}
+
+func userFields(user *User) []interface{} {
+	return []interface{}{
+		&user.UserId, &user.Username, &user.Email, &user.Password, &user.CreatedAt, &user.GameStat.PlayCount, &user.ProfilePic,
+		&user.EmailVerified, &user.PendingEmail, &user.FirebaseUid, &user.IsGuest, &user.Role, &user.Disabled,
+		&user.TOTPEnabled, &user.TOTPSecret, &user.TOTPLastStep, &user.RecoveryCodes,
+	}
+}
+
+// userValues dereferences userFields for use as query arguments
+func userValues(user User) []interface{} {
+	values := []interface{}{}
+	for _, field := range userFields(&user) {
+		values = append(values, reflect.ValueOf(field).Elem().Interface())
+	}
+	return values
+}
+
+// Value stores a StringList as a JSON array
+func (l StringList) Value() (driver.Value, error) {
+	if len(l) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal([]string(l))
+	return string(encoded), err
+}
+
+func (l *StringList) Scan(src interface{}) error {
+	var encoded string
+	switch value := src.(type) {
+	case nil:
+	case string:
+		encoded = value
+	case []byte:
+		encoded = string(value)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+
+	if encoded == "" {
+		*l = nil
+		return nil
+	}
+	return json.Unmarshal([]byte(encoded), (*[]string)(l))
+}
+
+// Value stores RoomRules as a JSON object, rooms without rules store ""
+func (r RoomRules) Value() (driver.Value, error) {
+	if r.Preset == "" {
+		return "", nil
+	}
+	encoded, err := json.Marshal(r)
+	return string(encoded), err
+}
+
+func (r *RoomRules) Scan(src interface{}) error {
+	var encoded string
+	switch value := src.(type) {
+	case nil:
+	case string:
+		encoded = value
+	case []byte:
+		encoded = string(value)
+	default:
+		return fmt.Errorf("cannot scan %T into RoomRules", src)
+	}
+
+	*r = RoomRules{}
+	if encoded == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(encoded), r)
+}
+
+func scanUser(row *sql.Row) (User, error) {
+	var user User
+	err := row.Scan(userFields(&user)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, ErrNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (s *SQLStore) CreateUser(user User) (User, error) {
+	user.UserId = newId()
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		err := s.saveReservations(tx, user.UserId, userReservations(user), nil)
+		if err != nil {
+			return err
+		}
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(userColumns)), ", ")
+		_, err = tx.Exec(s.rebind(`INSERT INTO users (`+strings.Join(userColumns, ", ")+`) VALUES (`+placeholders+`)`),
+			userValues(user)...)
+		return err
+	})
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *SQLStore) GetUser(userId string) (User, error) {
+	return s.findUser("id", userId)
+}
+
+func (s *SQLStore) GetUserByEmail(email string) (User, error) {
+	return s.findReserved(EmailKey(email))
+}
+
+func (s *SQLStore) GetUserByUsername(username string) (User, error) {
+	return s.findReserved(UsernameKey(username))
+}
+
+func (s *SQLStore) findReserved(key string) (User, error) {
+	row := s.db.QueryRow(s.rebind(`SELECT `+strings.Join(userColumns, ", ")+` FROM users
+		WHERE id = (SELECT user_id FROM reservations WHERE reservation_key = ?)`), key)
+	return scanUser(row)
+}
+
+func (s *SQLStore) GetUserByFirebaseUid(firebaseUid string) (User, error) {
+	return s.findUser("firebase_uid", firebaseUid)
+}
+
+// findUser looks up a single user by column, column is never user input
+func (s *SQLStore) findUser(column string, value string) (User, error) {
+	return s.loadUser(s.db, column, value, false)
+}
+
+func (s *SQLStore) loadUser(q queryer, column string, value string, forUpdate bool) (User, error) {
+	query := `SELECT ` + strings.Join(userColumns, ", ") + ` FROM users WHERE ` + column + ` = ? LIMIT 1`
+	if forUpdate && s.dialect == "postgres" {
+		query += ` FOR UPDATE`
+	}
+	return scanUser(q.QueryRow(s.rebind(query), value))
+}
+
+func (s *SQLStore) UpdateUser(user User) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		old, err := s.loadUser(tx, "id", user.UserId, true)
+		if err != nil {
+			return err
+		}
+
+		claim, release := reservationChanges(old, user)
+		err = s.saveReservations(tx, user.UserId, claim, release)
+		if err != nil {
+			return err
+		}
+
+		assignments := []string{}
+		for _, column := range userColumns[1:] {
+			assignments = append(assignments, column+" = ?")
+		}
+
+		values := append(userValues(user)[1:], user.UserId)
+		result, err := tx.Exec(s.rebind(`UPDATE users SET `+strings.Join(assignments, ", ")+` WHERE id = ?`), values...)
+		if err != nil {
+			return err
+		}
+
+		return expectRow(result)
+	})
+}
+
+func (s *SQLStore) DeleteUser(userId string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind(`DELETE FROM reservations WHERE user_id = ?`), userId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind(`DELETE FROM users WHERE id = ?`), userId)
+		return err
+	})
+}
+
+// saveReservations relies on the primary key of reservations, an insert that
+// conflicts means the key is held, by this user or someone else
+func (s *SQLStore) saveReservations(tx *sql.Tx, userId string, claim []reservation, release []string) error {
+	for _, key := range release {
+		_, err := tx.Exec(s.rebind(`DELETE FROM reservations WHERE reservation_key = ? AND user_id = ?`), key, userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range claim {
+		result, err := tx.Exec(s.rebind(`INSERT INTO reservations (reservation_key, user_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`), r.key, userId)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected > 0 {
+			continue
+		}
+
+		var owner string
+		err = tx.QueryRow(s.rebind(`SELECT user_id FROM reservations WHERE reservation_key = ?`), r.key).Scan(&owner)
+		if err != nil {
+			return err
+		}
+		if owner != userId {
+			return r.err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLStore) GetGuestsCreatedBefore(createdAt int64) ([]User, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT `+strings.Join(userColumns, ", ")+` FROM users
+		WHERE is_guest = ? AND created_at < ?`), true, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(userFields(&user)...); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func expectRow(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateRoom(room Room) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		// a concurrent create of the same id inserts nothing instead of failing
+		result, err := tx.Exec(s.rebind(`INSERT INTO rooms (id, created_at, owner_id, max_capacity, max_spectator, status, rules, bot_seats)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`),
+			room.RoomID, room.CreatedAt, room.OwnerID, room.MaxCapacity, room.MaxSpectator, room.Status, room.Rules, room.BotSeats)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrAlreadyExists
+		}
+
+		return s.saveRoomMembers(tx, room)
+	})
+}
+
+func (s *SQLStore) GetRoom(roomId string) (Room, error) {
+	return s.loadRoom(s.db, roomId, false)
+}
+
+func (s *SQLStore) UpdateRoom(roomId string, update func(room *Room) error) (Room, error) {
+	var updated Room
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		room, err := s.loadRoom(tx, roomId, true)
+		if err != nil {
+			return err
+		}
+
+		if err := update(&room); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind(`UPDATE rooms SET owner_id = ?, max_capacity = ?, max_spectator = ?, status = ?, rules = ?,
+			bot_seats = ? WHERE id = ?`),
+			room.OwnerID, room.MaxCapacity, room.MaxSpectator, room.Status, room.Rules, room.BotSeats, roomId)
+		if err != nil {
+			return err
+		}
+
+		updated = room
+		return s.saveRoomMembers(tx, room)
+	})
+	if err != nil {
+		return Room{}, err
+	}
+
+	return updated, nil
+}
+
+func (s *SQLStore) GetRoomsByMember(userId string) ([]Room, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT DISTINCT room_id FROM room_members WHERE user_id = ?`), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	roomIds := []string{}
+	for rows.Next() {
+		var roomId string
+		if err := rows.Scan(&roomId); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		roomIds = append(roomIds, roomId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rooms := []Room{}
+	for _, roomId := range roomIds {
+		room, err := s.loadRoom(s.db, roomId, false)
+		if err != nil {
+			return nil, err
+		}
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
+
+func (s *SQLStore) loadRoom(q queryer, roomId string, forUpdate bool) (Room, error) {
+	query := `SELECT id, created_at, owner_id, max_capacity, max_spectator, status, rules, bot_seats FROM rooms WHERE id = ?`
+	if forUpdate && s.dialect == "postgres" {
+		query += ` FOR UPDATE`
+	}
+
+	var room Room
+	err := q.QueryRow(s.rebind(query), roomId).Scan(&room.RoomID, &room.CreatedAt, &room.OwnerID,
+		&room.MaxCapacity, &room.MaxSpectator, &room.Status, &room.Rules, &room.BotSeats)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Room{}, ErrNotFound
+	}
+	if err != nil {
+		return Room{}, err
+	}
+
+	rows, err := q.Query(s.rebind(`SELECT user_id, role FROM room_members WHERE room_id = ? ORDER BY position`), roomId)
+	if err != nil {
+		return Room{}, err
+	}
+	defer rows.Close()
+
+	room.Players = []string{}
+	room.Spectators = []string{}
+	for rows.Next() {
+		var userId, role string
+		if err := rows.Scan(&userId, &role); err != nil {
+			return Room{}, err
+		}
+
+		if role == "player" {
+			room.Players = append(room.Players, userId)
+		} else {
+			room.Spectators = append(room.Spectators, userId)
+		}
+	}
+
+	return room, rows.Err()
+}
+
+// saveRoomMembers replaces the player and spectator lists, keeping their order
+func (s *SQLStore) saveRoomMembers(tx *sql.Tx, room Room) error {
+	_, err := tx.Exec(s.rebind(`DELETE FROM room_members WHERE room_id = ?`), room.RoomID)
+	if err != nil {
+		return err
+	}
+
+	insert := s.rebind(`INSERT INTO room_members (room_id, user_id, role, position) VALUES (?, ?, ?, ?)`)
+	for i, userId := range room.Players {
+		if _, err := tx.Exec(insert, room.RoomID, userId, "player", i); err != nil {
+			return err
+		}
+	}
+	for i, userId := range room.Spectators {
+		if _, err := tx.Exec(insert, room.RoomID, userId, "spectator", i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) CreateMatch(match Match) (Match, error) {
+	match.MatchId = newId()
+
+	err := s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind(`INSERT INTO matches (id, room_id, started_at, ended_at, winner_id)
+			VALUES (?, ?, ?, ?, ?)`),
+			match.MatchId, match.RoomId, match.StartedAt, match.EndedAt, match.WinnerId)
+		if err != nil {
+			return err
+		}
+
+		insert := s.rebind(`INSERT INTO match_players (match_id, user_id, player_name, placement, is_bot) VALUES (?, ?, ?, ?, ?)`)
+		for _, p := range match.Players {
+			if _, err := tx.Exec(insert, match.MatchId, p.PlayerId, p.PlayerName, p.Placement, p.IsBot); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Match{}, err
+	}
+
+	return match, nil
+}
+
+func (s *SQLStore) GetMatchesByUser(userId string) ([]Match, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT m.id, m.room_id, m.started_at, m.ended_at, m.winner_id
+		FROM matches m JOIN match_players mp ON mp.match_id = m.id
+		WHERE mp.user_id = ? AND NOT mp.is_bot ORDER BY m.ended_at DESC`), userId)
+	if err != nil {
+		return nil, err
+	}
+
+	matches := []Match{}
+	for rows.Next() {
+		var match Match
+		err := rows.Scan(&match.MatchId, &match.RoomId, &match.StartedAt, &match.EndedAt, &match.WinnerId)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// players are loaded after the first result set is closed, sqlite only has one connection
+	for i := range matches {
+		if err := s.loadMatchPlayers(&matches[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return matches, nil
+}
+
+func (s *SQLStore) AnonymizeMatchPlayer(userId string, anonymousId string, anonymousName string) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind(`UPDATE match_players SET user_id = ?, player_name = ? WHERE user_id = ?`),
+			anonymousId, anonymousName, userId)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind(`UPDATE matches SET winner_id = ? WHERE winner_id = ?`), anonymousId, userId)
+		return err
+	})
+}
+
+func (s *SQLStore) loadMatchPlayers(match *Match) error {
+	rows, err := s.db.Query(s.rebind(`SELECT user_id, player_name, placement, is_bot FROM match_players
+		WHERE match_id = ? ORDER BY placement`), match.MatchId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	match.Players = []MatchPlayer{}
+	match.PlayerIds = []string{}
+	for rows.Next() {
+		var p MatchPlayer
+		if err := rows.Scan(&p.PlayerId, &p.PlayerName, &p.Placement, &p.IsBot); err != nil {
+			return err
+		}
+		match.Players = append(match.Players, p)
+		if !p.IsBot {
+			match.PlayerIds = append(match.PlayerIds, p.PlayerId)
+		}
+	}
+	return rows.Err()
+}
+
+const sessionColumns = `id, user_id, refresh_token_hash, created_at, expires_at, revoked,
+	device_label, ip, user_agent, last_seen_at`
+
+// sessionFields must follow the order of sessionColumns
+func sessionFields(session *Session) []interface{} {
+	return []interface{}{
+		&session.SessionId, &session.UserId, &session.RefreshTokenHash, &session.CreatedAt, &session.ExpiresAt, &session.Revoked,
+		&session.DeviceLabel, &session.IP, &session.UserAgent, &session.LastSeenAt,
+	}
+}
+
+func (s *SQLStore) CreateSession(session Session) (Session, error) {
+	session.SessionId = newId()
+
+	_, err := s.db.Exec(s.rebind(`INSERT INTO sessions (`+sessionColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		session.SessionId, session.UserId, session.RefreshTokenHash,
+		session.CreatedAt, session.ExpiresAt, session.Revoked,
+		session.DeviceLabel, session.IP, session.UserAgent, session.LastSeenAt)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+func (s *SQLStore) GetSession(sessionId string) (Session, error) {
+	var session Session
+	err := s.db.QueryRow(s.rebind(`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`), sessionId).
+		Scan(sessionFields(&session)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrNotFound
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (s *SQLStore) GetSessionsByUser(userId string) ([]Session, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? ORDER BY created_at DESC`), userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(sessionFields(&session)...); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLStore) UpdateSession(session Session) error {
+	result, err := s.db.Exec(s.rebind(`UPDATE sessions SET refresh_token_hash = ?, expires_at = ?, revoked = ?,
+		device_label = ?, ip = ?, user_agent = ?, last_seen_at = ? WHERE id = ?`),
+		session.RefreshTokenHash, session.ExpiresAt, session.Revoked,
+		session.DeviceLabel, session.IP, session.UserAgent, session.LastSeenAt, session.SessionId)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
+
+func (s *SQLStore) TouchSession(sessionId string, lastSeenAt int64) error {
+	result, err := s.db.Exec(s.rebind(`UPDATE sessions SET last_seen_at = ? WHERE id = ?`), lastSeenAt, sessionId)
+	if err != nil {
+		return err
+	}
+
+	return expectRow(result)
+}
+
+func (s *SQLStore) RevokeUserSessions(userId string) error {
+	_, err := s.db.Exec(s.rebind(`UPDATE sessions SET revoked = ? WHERE user_id = ?`), true, userId)
+	return err
+}
+
+func (s *SQLStore) CreateToken(token Token) error {
+	_, err := s.db.Exec(s.rebind(`INSERT INTO tokens (hash, user_id, purpose, data, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`),
+		token.TokenHash, token.UserId, token.Purpose, token.Data, token.CreatedAt, token.ExpiresAt)
+	return err
+}
+
+func (s *SQLStore) ConsumeToken(tokenHash string, purpose string) (Token, error) {
+	token := Token{TokenHash: tokenHash, Purpose: purpose}
+
+	// a single DELETE ... RETURNING keeps concurrent consumers from both succeeding
+	err := s.db.QueryRow(s.rebind(`DELETE FROM tokens WHERE hash = ? AND purpose = ?
+		RETURNING user_id, data, created_at, expires_at`), tokenHash, purpose).
+		Scan(&token.UserId, &token.Data, &token.CreatedAt, &token.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Token{}, ErrNotFound
+	}
+	if err != nil {
+		return Token{}, err
+	}
+	return token, nil
+}
+
+func (s *SQLStore) DeleteUserTokens(userId string, purpose string) error {
+	_, err := s.db.Exec(s.rebind(`DELETE FROM tokens WHERE user_id = ? AND purpose = ?`), userId, purpose)
+	return err
+}
+
+func (s *SQLStore) AddLoginFailure(key string, failedAt int64) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(s.rebind(`DELETE FROM login_failures WHERE limiter_key = ? AND failed_at < ?`),
+			key, failedAt-loginFailureRetention)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(s.rebind(`INSERT INTO login_failures (limiter_key, failed_at) VALUES (?, ?)`), key, failedAt)
+		return err
+	})
+}
+
+func (s *SQLStore) GetLoginFailures(key string, since int64) ([]int64, error) {
+	rows, err := s.db.Query(s.rebind(`SELECT failed_at FROM login_failures
+		WHERE limiter_key = ? AND failed_at >= ? ORDER BY failed_at`), key, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	failures := []int64{}
+	for rows.Next() {
+		var failedAt int64
+		if err := rows.Scan(&failedAt); err != nil {
+			return nil, err
+		}
+		failures = append(failures, failedAt)
+	}
+	return failures, rows.Err()
+}
+
+func (s *SQLStore) ClearLoginFailures(key string) error {
+	_, err := s.db.Exec(s.rebind(`DELETE FROM login_failures WHERE limiter_key = ?`), key)
+	return err
+}
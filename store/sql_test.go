@@ -0,0 +1,155 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// newSQLiteStore opens an in-memory sqlite database migrated up to version,
+// the single connection keeps the database alive until the test ends
+func newSQLiteStore(t *testing.T, version int) *SQLStore {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	s := &SQLStore{db: db, dialect: "sqlite"}
+	if err := s.migrateTo(version); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func schemaVersion(t *testing.T, s *SQLStore) int {
+	t.Helper()
+
+	var version int
+	if err := s.db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	return version
+}
+
+func TestSQLMigrations(t *testing.T) {
+	s := newSQLiteStore(t, len(migrations))
+	if version := schemaVersion(t, s); version != len(migrations) {
+		t.Fatalf("schema at version %d, want %d", version, len(migrations))
+	}
+
+	// a migrated database is left alone at the next boot
+	if err := s.migrate(); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+	if version := schemaVersion(t, s); version != len(migrations) {
+		t.Errorf("schema at version %d after a second migrate, want %d", version, len(migrations))
+	}
+
+	// every column the store reads exists
+	user, err := s.CreateUser(User{Username: "alice", Email: "alice@example.com", RecoveryCodes: StringList{"a", "b"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.GetUser(user.UserId)
+	if err != nil || !reflect.DeepEqual(got, user) {
+		t.Errorf("GetUser = %+v, %v, want %+v", got, err, user)
+	}
+}
+
+func TestSQLReservationBackfill(t *testing.T) {
+	s := newSQLiteStore(t, 7)
+
+	// users from before reservations, two of them only differ by case
+	users := []struct {
+		id, username, email string
+		createdAt           int64
+	}{
+		{"u2", "ALICE", "Alice@Example.com", 2},
+		{"u1", "Alice", "alice@example.com", 1},
+		{"u3", "bob", "", 3},
+	}
+	for _, u := range users {
+		_, err := s.db.Exec(`INSERT INTO users (id, username, email, password, created_at) VALUES (?, ?, ?, '', ?)`,
+			u.id, u.username, u.email, u.createdAt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := s.db.Query(`SELECT reservation_key, user_id FROM reservations ORDER BY reservation_key`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	got := map[string]string{}
+	for rows.Next() {
+		var key, userId string
+		if err := rows.Scan(&key, &userId); err != nil {
+			t.Fatal(err)
+		}
+		got[key] = userId
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest user keeps the name
+	want := map[string]string{
+		UsernameKey("alice"):          "u1",
+		EmailKey("alice@example.com"): "u1",
+		UsernameKey("bob"):            "u3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reservations %v, want %v", got, want)
+	}
+
+	if user, err := s.GetUserByUsername("Bob"); err != nil || user.UserId != "u3" {
+		t.Errorf("GetUserByUsername(Bob) = %q, %v, want u3", user.UserId, err)
+	}
+	if _, err := s.CreateUser(User{Username: "BOB"}); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("CreateUser(BOB) = %v, want %v", err, ErrUsernameTaken)
+	}
+}
+
+func TestSQLCreateRoom(t *testing.T) {
+	s := newSQLiteStore(t, len(migrations))
+
+	room := Room{
+		RoomID:     "ROOM1",
+		OwnerID:    "u1",
+		Status:     "waiting",
+		Players:    []string{"u1", "u2"},
+		Spectators: []string{"u3"},
+		Rules:      RoomRules{Preset: "classic", TargetValue: 99},
+	}
+	if err := s.CreateRoom(room); err != nil {
+		t.Fatal(err)
+	}
+
+	taken := room
+	taken.OwnerID = "u9"
+	if err := s.CreateRoom(taken); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateRoom with a taken id = %v, want %v", err, ErrAlreadyExists)
+	}
+
+	got, err := s.GetRoom(room.RoomID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OwnerID != "u1" || !reflect.DeepEqual(got.Players, room.Players) || !reflect.DeepEqual(got.Spectators, room.Spectators) {
+		t.Errorf("GetRoom = %+v, want the first room", got)
+	}
+	if !reflect.DeepEqual(got.Rules, room.Rules) {
+		t.Errorf("rules %+v, want %+v", got.Rules, room.Rules)
+	}
+}
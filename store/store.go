@@ -0,0 +1,209 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	Firebase "ninetynine/firebase"
+)
+
+type GameStat struct {
+	PlayCount int `json:"playCount" firestore:"playCount"`
+}
+
+type User struct {
+	UserId     string   `json:"userId" firestore:"-"`
+	Username   string   `json:"username" firestore:"username"`
+	Email      string   `json:"email" firestore:"email"`
+	Password   string   `json:"-" firestore:"password"`
+	CreatedAt  int64    `json:"createdAt" firestore:"createdAt"`
+	GameStat   GameStat `json:"gamestat" firestore:"gamestat"`
+	ProfilePic string   `json:"profilePic" firestore:"profilePic"`
+
+	EmailVerified bool   `json:"emailVerified" firestore:"emailVerified"`
+	PendingEmail  string `json:"pendingEmail" firestore:"pendingEmail"` // new address waiting for confirmation
+	FirebaseUid   string `json:"-" firestore:"firebaseUid"`             // linked Firebase Auth account
+	IsGuest       bool   `json:"isGuest" firestore:"isGuest"`           // no email or password until upgraded
+	Role          string `json:"role" firestore:"role"`                 // "player", "moderator" or "admin", empty means player
+	Disabled      bool   `json:"disabled" firestore:"disabled"`         // disabled accounts cannot sign in
+
+	TOTPEnabled   bool       `json:"totpEnabled" firestore:"totpEnabled"`
+	TOTPSecret    string     `json:"-" firestore:"totpSecret"`    // base32, set on setup and kept once confirmed
+	TOTPLastStep  int64      `json:"-" firestore:"totpLastStep"`  // last accepted time step, codes are single use
+	RecoveryCodes StringList `json:"-" firestore:"recoveryCodes"` // hashes of the unused recovery codes
+}
+
+// StringList is a list of strings kept in a single column by the sql backends
+type StringList []string
+
+type Room struct {
+	RoomID       string   `json:"roomId" firestore:"roomId"`
+	CreatedAt    int64    `json:"createdAt" firestore:"createdAt"`
+	OwnerID      string   `json:"ownerId" firestore:"ownerId"`
+	MaxCapacity  int      `json:"maxCapacity" firestore:"maxCapacity"`
+	MaxSpectator int      `json:"maxSpectator" firestore:"maxSpectator"`
+	Status       string   `json:"status" firestore:"status"`
+	Players      []string `json:"players" firestore:"players"`
+	Spectators   []string `json:"spectators" firestore:"spectators"`
+	BotSeats     int      `json:"botSeats" firestore:"botSeats"` // seats taken by bots, they count against MaxCapacity
+
+	Rules RoomRules `json:"rules" firestore:"rules"`
+}
+
+// RoomRules is the rule set a room plays with, the room package validates it.
+// Rooms created before rule sets have an empty Preset and play the classic rules.
+type RoomRules struct {
+	Preset        string   `json:"preset" firestore:"preset"` // a named preset or "custom"
+	TargetValue   int      `json:"targetValue" firestore:"targetValue"`
+	HandSize      int      `json:"handSize" firestore:"handSize"`
+	Specials      []string `json:"specials" firestore:"specials"` // names of the special cards in play
+	NegativeCards bool     `json:"negativeCards" firestore:"negativeCards"`
+	AtLimit       string   `json:"atLimit" firestore:"atLimit"` // what a card reaching exactly the target does
+	// TurnSeconds is the clock of each turn, 0 for no clock. A player who
+	// runs over it draws on their TimeBankSeconds for the whole game, then
+	// OnTimeout says what happens to them.
+	TurnSeconds     int    `json:"turnSeconds" firestore:"turnSeconds"`
+	TimeBankSeconds int    `json:"timeBankSeconds" firestore:"timeBankSeconds"`
+	OnTimeout       string `json:"onTimeout" firestore:"onTimeout"`
+	// Rounds in a match, 0 for rooms created before matches plays one. Each
+	// player has Lives, or survivors of a round score points when it is 0.
+	Rounds int `json:"rounds" firestore:"rounds"`
+	Lives  int `json:"lives" firestore:"lives"`
+	// BotTakeover lets a bot play for players that disconnect mid-game, who
+	// stay in the room and can connect again to take their seat back
+	BotTakeover bool `json:"botTakeover" firestore:"botTakeover"`
+}
+
+type MatchPlayer struct {
+	PlayerId   string `json:"playerId" firestore:"playerId"`
+	PlayerName string `json:"playerName" firestore:"playerName"`
+	// Placement is 1 for the winner, then in reverse order of elimination
+	Placement int `json:"placement" firestore:"placement"`
+	// IsBot marks bots, whose PlayerId is not a user and stays out of PlayerIds
+	IsBot bool `json:"isBot" firestore:"isBot"`
+}
+
+type Match struct {
+	MatchId   string        `json:"matchId" firestore:"-"`
+	RoomId    string        `json:"roomId" firestore:"roomId"`
+	StartedAt int64         `json:"startedAt" firestore:"startedAt"`
+	EndedAt   int64         `json:"endedAt" firestore:"endedAt"`
+	WinnerId  string        `json:"winnerId" firestore:"winnerId"`
+	PlayerIds []string      `json:"-" firestore:"playerIds"` // indexed for lookups by player
+	Players   []MatchPlayer `json:"players" firestore:"players"`
+}
+
+// Session backs a refresh token. Access tokens carry the session id so
+// revoking the session invalidates them as well.
+type Session struct {
+	SessionId        string `json:"sessionId" firestore:"-"`
+	UserId           string `json:"userId" firestore:"userId"`
+	RefreshTokenHash string `json:"-" firestore:"refreshTokenHash"`
+	CreatedAt        int64  `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt        int64  `json:"expiresAt" firestore:"expiresAt"`
+	Revoked          bool   `json:"revoked" firestore:"revoked"`
+
+	DeviceLabel string `json:"deviceLabel" firestore:"deviceLabel"` // e.g. "Firefox on Windows", from the user agent
+	IP          string `json:"ip" firestore:"ip"`                   // address of the last sign in or refresh
+	UserAgent   string `json:"userAgent" firestore:"userAgent"`
+	LastSeenAt  int64  `json:"lastSeenAt" firestore:"lastSeenAt"`
+}
+
+// Token is a single use secret sent to the user, e.g. a password reset link.
+// Only the hash of the secret is stored.
+type Token struct {
+	TokenHash string `json:"-" firestore:"-"`
+	UserId    string `json:"userId" firestore:"userId"`
+	Purpose   string `json:"purpose" firestore:"purpose"`
+	Data      string `json:"data" firestore:"data"` // purpose specific payload
+	CreatedAt int64  `json:"createdAt" firestore:"createdAt"`
+	ExpiresAt int64  `json:"expiresAt" firestore:"expiresAt"`
+}
+
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrAlreadyExists = errors.New("already exists")
+)
+
+// Store is the persistence layer shared by the auth, room and websocket
+// packages. Lookups return ErrNotFound when the document does not exist.
+type Store interface {
+	CreateUser(user User) (User, error)
+	GetUser(userId string) (User, error)
+	GetUserByEmail(email string) (User, error)
+	GetUserByUsername(username string) (User, error)
+	GetUserByFirebaseUid(firebaseUid string) (User, error)
+	UpdateUser(user User) error
+	DeleteUser(userId string) error
+	GetGuestsCreatedBefore(createdAt int64) ([]User, error)
+
+	// CreateRoom returns ErrAlreadyExists if the room id is taken
+	CreateRoom(room Room) error
+	GetRoom(roomId string) (Room, error)
+	// UpdateRoom runs update against the current room and saves the result
+	// atomically. If update returns an error nothing is written.
+	UpdateRoom(roomId string, update func(room *Room) error) (Room, error)
+	// GetRoomsByMember returns the rooms listing the user as player or spectator
+	GetRoomsByMember(userId string) ([]Room, error)
+
+	CreateMatch(match Match) (Match, error)
+	// GetMatchesByUser returns the matches a user played, newest first
+	GetMatchesByUser(userId string) ([]Match, error)
+	// AnonymizeMatchPlayer replaces a player in every match they played
+	AnonymizeMatchPlayer(userId string, anonymousId string, anonymousName string) error
+
+	CreateSession(session Session) (Session, error)
+	GetSession(sessionId string) (Session, error)
+	GetSessionsByUser(userId string) ([]Session, error)
+	UpdateSession(session Session) error
+	// TouchSession only sets lastSeenAt, so it cannot undo a concurrent revoke
+	TouchSession(sessionId string, lastSeenAt int64) error
+	RevokeUserSessions(userId string) error
+
+	CreateToken(token Token) error
+	// ConsumeToken deletes the token and returns it, so it can only be used once.
+	// It returns ErrNotFound if no token with that hash and purpose exists.
+	ConsumeToken(tokenHash string, purpose string) (Token, error)
+	DeleteUserTokens(userId string, purpose string) error
+
+	// login failures back the shared login limiter, key is an ip or an account
+	AddLoginFailure(key string, failedAt int64) error
+	GetLoginFailures(key string, since int64) ([]int64, error)
+	ClearLoginFailures(key string) error
+}
+
+// failures older than this are dropped whenever a new one is recorded
+const loginFailureRetention = 24 * 60 * 60
+
+var DB Store
+
+// Initialize selects the storage backend by name ("firestore", "memory",
+// "sqlite" or "postgres"). databaseURL is only used by the SQL backends.
+func Initialize(backend string, databaseURL string) error {
+	if backend == "" {
+		backend = "firestore"
+	}
+
+	switch backend {
+	case "firestore":
+		Firebase.InitializeFirebase()
+		firestoreStore := NewFirestoreStore(Firebase.FirestoreClient)
+		if err := firestoreStore.backfillReservations(); err != nil {
+			return err
+		}
+		DB = firestoreStore
+	case "memory":
+		DB = NewMemoryStore()
+	case "sqlite", "postgres":
+		sqlStore, err := NewSQLStore(backend, databaseURL)
+		if err != nil {
+			return err
+		}
+		DB = sqlStore
+	default:
+		return fmt.Errorf("unknown store backend %q", backend)
+	}
+
+	fmt.Println("Using", backend, "store")
+	return nil
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testStore checks the behavior every backend promises through the Store
+// interface, newStore returns an empty store
+func testStore(t *testing.T, newStore func(t *testing.T) Store) {
+	t.Run("missing documents", func(t *testing.T) {
+		s := newStore(t)
+
+		lookups := map[string]func() error{
+			"GetUser":              func() error { _, err := s.GetUser("missing"); return err },
+			"GetUserByEmail":       func() error { _, err := s.GetUserByEmail("missing@example.com"); return err },
+			"GetUserByUsername":    func() error { _, err := s.GetUserByUsername("missing"); return err },
+			"GetUserByFirebaseUid": func() error { _, err := s.GetUserByFirebaseUid("missing"); return err },
+			"UpdateUser":           func() error { return s.UpdateUser(User{UserId: "missing", Username: "missing"}) },
+			"GetRoom":              func() error { _, err := s.GetRoom("MISSING"); return err },
+			"UpdateRoom": func() error {
+				_, err := s.UpdateRoom("MISSING", func(room *Room) error { return nil })
+				return err
+			},
+			"GetSession":   func() error { _, err := s.GetSession("missing"); return err },
+			"ConsumeToken": func() error { _, err := s.ConsumeToken("missing", "reset"); return err },
+		}
+		for name, lookup := range lookups {
+			if err := lookup(); !errors.Is(err, ErrNotFound) {
+				t.Errorf("%s = %v, want %v", name, err, ErrNotFound)
+			}
+		}
+
+		// nothing was created on the way
+		if _, err := s.GetUserByUsername("missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateUser of a missing user reserved its name")
+		}
+	})
+
+	t.Run("names are unique regardless of case", func(t *testing.T) {
+		s := newStore(t)
+
+		alice, err := s.CreateUser(User{Username: "Alice", Email: "alice@example.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.CreateUser(User{Username: "ALICE", Email: "other@example.com"}); !errors.Is(err, ErrUsernameTaken) {
+			t.Errorf("CreateUser(ALICE) = %v, want %v", err, ErrUsernameTaken)
+		}
+		if _, err := s.CreateUser(User{Username: "bob", Email: "Alice@Example.com"}); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("CreateUser with a taken email = %v, want %v", err, ErrEmailTaken)
+		}
+
+		// renaming releases the old name
+		alice.Username = "Alicia"
+		if err := s.UpdateUser(alice); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.CreateUser(User{Username: "alice"}); err != nil {
+			t.Errorf("CreateUser(alice) after the rename = %v", err)
+		}
+		if user, err := s.GetUserByUsername("ALICIA"); err != nil || user.UserId != alice.UserId {
+			t.Errorf("GetUserByUsername(ALICIA) = %q, %v, want %q", user.UserId, err, alice.UserId)
+		}
+	})
+
+	t.Run("users are copied", func(t *testing.T) {
+		s := newStore(t)
+
+		user, err := s.CreateUser(User{Username: "alice", RecoveryCodes: StringList{"a", "b"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		user.RecoveryCodes[0] = "changed"
+
+		got, err := s.GetUser(user.UserId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got.RecoveryCodes[1] = "changed"
+
+		got, err = s.GetUser(user.UserId)
+		if err != nil || !reflect.DeepEqual(got.RecoveryCodes, StringList{"a", "b"}) {
+			t.Errorf("recovery codes %v, %v, want the stored [a b]", got.RecoveryCodes, err)
+		}
+	})
+
+	t.Run("room ids are unique", func(t *testing.T) {
+		s := newStore(t)
+
+		room := Room{RoomID: "ROOM1", OwnerID: "u1", Status: "waiting", Players: []string{"u1"}, Spectators: []string{}}
+		if err := s.CreateRoom(room); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.CreateRoom(room); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("second CreateRoom = %v, want %v", err, ErrAlreadyExists)
+		}
+	})
+
+	t.Run("a failed room update writes nothing", func(t *testing.T) {
+		s := newStore(t)
+
+		room := Room{RoomID: "ROOM1", OwnerID: "u1", Status: "waiting", Players: []string{"u1"}, Spectators: []string{}}
+		if err := s.CreateRoom(room); err != nil {
+			t.Fatal(err)
+		}
+
+		failed := errors.New("update failed")
+		_, err := s.UpdateRoom(room.RoomID, func(room *Room) error {
+			room.Status = "playing"
+			room.Players[0] = "u2"
+			room.Players = append(room.Players, "u3")
+			return failed
+		})
+		if !errors.Is(err, failed) {
+			t.Errorf("UpdateRoom = %v, want the error of the update", err)
+		}
+
+		got, err := s.GetRoom(room.RoomID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != "waiting" || !reflect.DeepEqual(got.Players, []string{"u1"}) {
+			t.Errorf("room %+v after a failed update, want it unchanged", got)
+		}
+	})
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return NewMemoryStore() })
+}
+
+func TestSQLStore(t *testing.T) {
+	testStore(t, func(t *testing.T) Store { return newSQLiteStore(t, len(migrations)) })
+}
@@ -0,0 +1,38 @@
+package throttle
+
+import (
+	"fmt"
+	"time"
+)
+
+// Limiter records failed attempts per key. The login policy in login.go is
+// built on top of it.
+type Limiter interface {
+	AddFailure(key string, failedAt time.Time) error
+	// Failures returns the failures for key since the given time, oldest first
+	Failures(key string, since time.Time) ([]time.Time, error)
+	Reset(key string) error
+}
+
+var Backend Limiter
+
+// Initialize selects where failures are kept. "memory" (the default) only
+// limits a single instance, "store" shares failures through the store so it
+// works across instances.
+func Initialize(backend string) error {
+	if backend == "" {
+		backend = "memory"
+	}
+
+	switch backend {
+	case "memory":
+		Backend = NewMemoryLimiter()
+	case "store":
+		Backend = NewStoreLimiter()
+	default:
+		return fmt.Errorf("unknown limiter backend %q", backend)
+	}
+
+	fmt.Println("Using", backend, "login limiter")
+	return nil
+}
@@ -0,0 +1,172 @@
+package throttle
+
+import (
+	"strings"
+	"time"
+)
+
+// Policy decides how failures within a sliding window slow down a key.
+// After FreeAttempts failures every attempt has to wait twice as long as the
+// previous one, up to MaxDelay. LockoutAttempts failures lock the key for
+// LockoutDuration after the last failure, 0 disables the lockout.
+type Policy struct {
+	Window          time.Duration
+	FreeAttempts    int
+	MaxDelay        time.Duration
+	LockoutAttempts int
+	LockoutDuration time.Duration
+}
+
+// IPPolicy is loose since many players can share an address
+var IPPolicy = Policy{
+	Window:       15 * time.Minute,
+	FreeAttempts: 20,
+	MaxDelay:     time.Minute,
+}
+
+var AccountPolicy = Policy{
+	Window:          15 * time.Minute,
+	FreeAttempts:    5,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 10,
+	LockoutDuration: 15 * time.Minute,
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// RetryAfter returns how long key has to wait before its next attempt, and
+// whether that is because of a lockout
+func RetryAfter(key string, policy Policy, now time.Time) (time.Duration, bool, error) {
+	lookback := policy.Window
+	if policy.LockoutDuration > lookback {
+		lookback = policy.LockoutDuration
+	}
+
+	failures, err := Backend.Failures(key, now.Add(-lookback))
+	if err != nil {
+		return 0, false, err
+	}
+	if len(failures) == 0 {
+		return 0, false, nil
+	}
+
+	last := failures[len(failures)-1]
+
+	if policy.LockoutAttempts > 0 && len(failures) >= policy.LockoutAttempts {
+		if wait := last.Add(policy.LockoutDuration).Sub(now); wait > 0 {
+			return wait, true, nil
+		}
+	}
+
+	inWindow := 0
+	for _, failedAt := range failures {
+		if failedAt.After(now.Add(-policy.Window)) {
+			inWindow++
+		}
+	}
+
+	if inWindow <= policy.FreeAttempts {
+		return 0, false, nil
+	}
+
+	delay := policy.MaxDelay
+	if shift := inWindow - policy.FreeAttempts - 1; shift < 30 {
+		delay = time.Duration(1<<shift) * time.Second
+		if delay > policy.MaxDelay {
+			delay = policy.MaxDelay
+		}
+	}
+
+	wait := last.Add(delay).Sub(now)
+	if wait < 0 {
+		wait = 0
+	}
+	return wait, false, nil
+}
+
+// CheckLogin returns how long a login from ip for email has to wait, the
+// longest of the ip and account limits
+func CheckLogin(ip string, email string) (time.Duration, bool, error) {
+	now := time.Now()
+
+	ipWait, _, err := RetryAfter(IPKey(ip), IPPolicy, now)
+	if err != nil {
+		return 0, false, err
+	}
+
+	accountWait, locked, err := RetryAfter(AccountKey(email), AccountPolicy, now)
+	if err != nil {
+		return 0, false, err
+	}
+
+	if ipWait > accountWait {
+		return ipWait, false, nil
+	}
+	return accountWait, locked, nil
+}
+
+// LoginFailed records a failed login. lockedNow is true for the failure that
+// locks the account, so the caller can notify the owner once.
+func LoginFailed(ip string, email string) (bool, error) {
+	now := time.Now()
+
+	err := Backend.AddFailure(IPKey(ip), now)
+	if err != nil {
+		return false, err
+	}
+
+	return accountFailed(email, now)
+}
+
+// CheckPassword returns how long a password check of a signed in account has
+// to wait, it shares the account limit with logins
+func CheckPassword(email string) (time.Duration, bool, error) {
+	return RetryAfter(AccountKey(email), AccountPolicy, time.Now())
+}
+
+// PasswordFailed records a wrong password given to confirm a change, lockedNow
+// is the same as for LoginFailed
+func PasswordFailed(email string) (bool, error) {
+	return accountFailed(email, time.Now())
+}
+
+// accountFailed records a failure of the account, it reports whether the
+// count crossed the lockout limit. Concurrent failures can skip a count, so
+// it looks at the counts before and after instead of matching the limit.
+func accountFailed(email string, now time.Time) (bool, error) {
+	from := now.Add(-AccountPolicy.Window)
+	before, err := Backend.Failures(AccountKey(email), from)
+	if err != nil {
+		return false, err
+	}
+
+	err = Backend.AddFailure(AccountKey(email), now)
+	if err != nil {
+		return false, err
+	}
+
+	after, err := Backend.Failures(AccountKey(email), from)
+	if err != nil {
+		return false, err
+	}
+
+	limit := AccountPolicy.LockoutAttempts
+	return limit > 0 && len(before) < limit && len(after) >= limit, nil
+}
+
+// LoginSucceeded clears the account failures. The ip failures are kept so a
+// valid login cannot be used to reset guessing against other accounts.
+func LoginSucceeded(email string) error {
+	return Backend.Reset(AccountKey(email))
+}
+
+// Unlock lifts an account lockout
+func Unlock(email string) error {
+	return Backend.Reset(AccountKey(email))
+}
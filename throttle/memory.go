@@ -0,0 +1,55 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+type MemoryLimiter struct {
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{failures: make(map[string][]time.Time)}
+}
+
+// retention bounds memory use, no policy looks further back than this
+const retention = 24 * time.Hour
+
+func (l *MemoryLimiter) AddFailure(key string, failedAt time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.failures[key] = append(since(l.failures[key], failedAt.Add(-retention)), failedAt)
+	return nil
+}
+
+func (l *MemoryLimiter) Failures(key string, from time.Time) ([]time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	failures := since(l.failures[key], from)
+	if len(failures) == 0 {
+		delete(l.failures, key)
+	}
+	return failures, nil
+}
+
+func (l *MemoryLimiter) Reset(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.failures, key)
+	return nil
+}
+
+func since(failures []time.Time, from time.Time) []time.Time {
+	recent := []time.Time{}
+	for _, failedAt := range failures {
+		if !failedAt.Before(from) {
+			recent = append(recent, failedAt)
+		}
+	}
+	return recent
+}
@@ -0,0 +1,19 @@
+package throttle
+
+import "time"
+
+// PasswordResetKey limits reset requests per ip with IPPolicy. Every request
+// can send a mail, so all of them count and not only failures.
+func PasswordResetKey(ip string) string {
+	return "reset:" + ip
+}
+
+// CheckPasswordReset returns how long the next reset request from ip has to wait
+func CheckPasswordReset(ip string) (time.Duration, error) {
+	wait, _, err := RetryAfter(PasswordResetKey(ip), IPPolicy, time.Now())
+	return wait, err
+}
+
+func PasswordResetRequested(ip string) error {
+	return Backend.AddFailure(PasswordResetKey(ip), time.Now())
+}
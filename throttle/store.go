@@ -0,0 +1,35 @@
+package throttle
+
+import (
+	"time"
+
+	Store "ninetynine/store"
+)
+
+// StoreLimiter keeps failures in the store so every instance sees them
+type StoreLimiter struct{}
+
+func NewStoreLimiter() *StoreLimiter {
+	return &StoreLimiter{}
+}
+
+func (l *StoreLimiter) AddFailure(key string, failedAt time.Time) error {
+	return Store.DB.AddLoginFailure(key, failedAt.Unix())
+}
+
+func (l *StoreLimiter) Failures(key string, from time.Time) ([]time.Time, error) {
+	failures, err := Store.DB.GetLoginFailures(key, from.Unix())
+	if err != nil {
+		return nil, err
+	}
+
+	times := []time.Time{}
+	for _, failedAt := range failures {
+		times = append(times, time.Unix(failedAt, 0))
+	}
+	return times, nil
+}
+
+func (l *StoreLimiter) Reset(key string) error {
+	return Store.DB.ClearLoginFailures(key)
+}
@@ -0,0 +1,31 @@
+package throttle
+
+import "time"
+
+// TwoFactorPolicy limits guessing of 2FA codes per account. A six digit code
+// is far easier to guess than a password, so it locks out sooner.
+var TwoFactorPolicy = Policy{
+	Window:          15 * time.Minute,
+	FreeAttempts:    3,
+	MaxDelay:        time.Minute,
+	LockoutAttempts: 8,
+	LockoutDuration: 30 * time.Minute,
+}
+
+func TwoFactorKey(userId string) string {
+	return "2fa:" + userId
+}
+
+// CheckTwoFactor returns how long the next code for userId has to wait
+func CheckTwoFactor(userId string) (time.Duration, error) {
+	wait, _, err := RetryAfter(TwoFactorKey(userId), TwoFactorPolicy, time.Now())
+	return wait, err
+}
+
+func TwoFactorFailed(userId string) error {
+	return Backend.AddFailure(TwoFactorKey(userId), time.Now())
+}
+
+func TwoFactorSucceeded(userId string) error {
+	return Backend.Reset(TwoFactorKey(userId))
+}
@@ -0,0 +1,202 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	Avatar "ninetynine/avatar"
+	Bot "ninetynine/bot"
+	Engine "ninetynine/engine"
+)
+
+var (
+	errUnknownStrategy = errors.New("unknown bot strategy")
+	errNotABot         = errors.New("player is not a bot")
+)
+
+// bots take this long and up to botThinkTime more to play, like a person
+const (
+	botMinDelay  = 800 * time.Millisecond
+	botThinkTime = 1200 * time.Millisecond
+)
+
+// botPlayer plays a seat of the game, for a bot added in the lobby or for a
+// human that disconnected while playing
+type botPlayer struct {
+	strategy Bot.Strategy
+	takeover bool
+}
+
+// AddBot seats a bot playing the named strategy in a game that waits for
+// players
+func (game *Game) AddBot(strategyName string) error {
+	strategy, exists := Bot.Strategies[strategyName]
+	if !exists {
+		return errUnknownStrategy
+	}
+
+	game.mu.Lock()
+	game.botCount++
+	playerId := fmt.Sprintf("bot-%d", game.botCount)
+	playerName := fmt.Sprintf("Bot %d (%s)", game.botCount, strategyName)
+	game.bots[playerId] = botPlayer{strategy: strategy}
+	game.mu.Unlock()
+
+	err := game.Do(Engine.Join{
+		PlayerId:        playerId,
+		PlayerName:      playerName,
+		PlayerAvatarURL: Avatar.DefaultURL(playerId),
+	})
+	if err != nil {
+		game.mu.Lock()
+		delete(game.bots, playerId)
+		game.mu.Unlock()
+	}
+	return err
+}
+
+// RemoveBot takes a bot added in the lobby out of the game
+func (game *Game) RemoveBot(playerId string) error {
+	err := game.doChecked(Engine.Leave{PlayerId: playerId}, func(state Engine.State) error {
+		game.mu.RLock()
+		bot, exists := game.bots[playerId]
+		game.mu.RUnlock()
+		if !exists || bot.takeover {
+			return errNotABot
+		}
+
+		if state.Status != Engine.StatusWaiting {
+			return Engine.ErrGameStarted
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	game.mu.Lock()
+	delete(game.bots, playerId)
+	game.mu.Unlock()
+	return nil
+}
+
+// BotSeats is the number of bots added in the lobby
+func (game *Game) BotSeats() int {
+	game.mu.RLock()
+	defer game.mu.RUnlock()
+	seats := 0
+	for _, bot := range game.bots {
+		if !bot.takeover {
+			seats++
+		}
+	}
+	return seats
+}
+
+// isBot reports whether a player was added as a bot
+func (game *Game) isBot(playerId string) bool {
+	game.mu.RLock()
+	defer game.mu.RUnlock()
+	bot, exists := game.bots[playerId]
+	return exists && !bot.takeover
+}
+
+// TakeOver lets a bot play for a human that disconnected mid-game, until they
+// join again. It reports false when the player is not in a running game or
+// the rules do not allow it.
+func (game *Game) TakeOver(playerId string) bool {
+	game.mu.Lock()
+	state := game.state
+	i := state.PlayerIndex(playerId)
+	if !game.rules.BotTakeover || state.Status != Engine.StatusPlaying || i == -1 {
+		game.mu.Unlock()
+		return false
+	}
+
+	// nothing is left to play for a player that is out for good
+	player := state.Players[i]
+	lastRound := state.Round >= state.Rules.Rounds
+	noLives := state.Rules.Lives > 0 && player.Lives == 0
+	if player.Status == Engine.PlayerHasLeft || (player.IsOut && (lastRound || noLives)) {
+		game.mu.Unlock()
+		return false
+	}
+
+	game.bots[playerId] = botPlayer{strategy: Bot.Strategies[Bot.DefaultStrategy], takeover: true}
+	game.mu.Unlock()
+
+	// wake the game goroutine in case it is this player's turn
+	go func() {
+		select {
+		case game.botWake <- struct{}{}:
+		case <-game.done:
+		}
+	}()
+	return true
+}
+
+// handBack ends the takeover of a human that joined again
+func (game *Game) handBack(playerId string) bool {
+	game.mu.Lock()
+	defer game.mu.Unlock()
+	if bot, exists := game.bots[playerId]; exists && bot.takeover {
+		delete(game.bots, playerId)
+		return true
+	}
+	return false
+}
+
+// scheduleBot starts the move of the current player when a bot plays for
+// them, it runs in the game goroutine
+func (game *Game) scheduleBot() {
+	if game.botTimer != nil {
+		game.botTimer.Stop()
+		game.botTimer = nil
+	}
+
+	state := game.State()
+	if state.Status != Engine.StatusPlaying {
+		return
+	}
+
+	game.mu.RLock()
+	_, exists := game.bots[state.Players[state.CurrentPlayerIndex].PlayerId]
+	game.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	delay := botMinDelay + time.Duration(game.botRNG.Intn(int(botThinkTime/time.Millisecond)))*time.Millisecond
+	game.botTimer = time.NewTimer(delay)
+}
+
+// botMove fires when the scheduled bot move is due, it is nil otherwise
+func (game *Game) botMove() <-chan time.Time {
+	if game.botTimer == nil {
+		return nil
+	}
+	return game.botTimer.C
+}
+
+// playBot picks the move of the bot playing the current turn, it goes through
+// the engine like the play of a client
+func (game *Game) playBot() (Engine.Action, bool) {
+	game.botTimer = nil
+	state := game.State()
+	playerId := state.Players[state.CurrentPlayerIndex].PlayerId
+
+	game.mu.RLock()
+	bot, exists := game.bots[playerId]
+	game.mu.RUnlock()
+	if !exists {
+		return nil, false
+	}
+
+	play, ok := bot.strategy(state, playerId, &game.botRNG)
+	if !ok {
+		return nil, false
+	}
+	play.PlayerId = playerId
+	return play, true
+}
@@ -5,13 +5,25 @@ import (
 	"fmt"
 	"log"
 
+	Bot "ninetynine/bot"
+	Engine "ninetynine/engine"
+	Room "ninetynine/room"
+	Store "ninetynine/store"
+
 	"github.com/gorilla/websocket"
 )
 
+// Client is one websocket connection. ID, Name and AvatarURL are taken from
+// the authenticated user when the connection is upgraded, revoking SessionId
+// closes the connection.
 type Client struct {
-	ID   string
-	Conn *websocket.Conn
-	Pool *Pool
+	ID          string
+	SessionId   string
+	Name        string
+	AvatarURL   string
+	IsSpectator bool
+	Conn        *websocket.Conn
+	Pool        *Pool
 }
 
 type Message struct {
@@ -26,22 +38,32 @@ type PlayerMessage struct {
 	PlayerAvatarURL string `json:"playerAvatarURL"`
 	IsOut           bool   `json:"isOut"`
 	Status          string `json:"status"`
+	TimeBank        int    `json:"timeBank"`  // seconds left in the player's time bank
+	IsBot           bool   `json:"isBot"`     // added by the owner
+	TakenOver       bool   `json:"takenOver"` // disconnected, a bot plays for them
 }
 
 type GameMessage struct {
-	Players            []PlayerMessage `json:"players"`
-	PlayerCards        []Card          `json:"playerCards"`
-	Status             string          `json:"status"`
-	CurrentPlayerIndex int             `json:"currentPlayerIndex"`
-	CurrentDirection   int             `json:"currentDirection"`
-	StackValue         int             `json:"stackValue"`
-	MaxStackValue      int             `json:"maxStackValue"`
-	LastPlayedCard     Card            `json:"lastPlayedCard"`
+	Players            []PlayerMessage   `json:"players"`
+	PlayerCards        []Engine.Card     `json:"playerCards"`
+	Status             string            `json:"status"`
+	CurrentPlayerIndex int               `json:"currentPlayerIndex"`
+	CurrentDirection   int               `json:"currentDirection"`
+	StackValue         int               `json:"stackValue"`
+	MaxStackValue      int               `json:"maxStackValue"`
+	LastPlayedCard     Engine.PlayedCard `json:"lastPlayedCard"`
+	DrawPileSize       int               `json:"drawPileSize"`
+	Rules              Store.RoomRules   `json:"rules"`
+	TurnTimeLeft       int               `json:"turnTimeLeft"` // seconds left of the current turn, without the time bank
+	Round              int               `json:"round"`
+	Standings          []Engine.Standing `json:"standings"`
 }
 
 func (c *Client) Read() {
+	trackConnection(c)
 	defer func() {
-		c.Pool.Unregister <- c
+		untrackConnection(c)
+		c.Pool.leave(c)
 		c.Conn.Close()
 	}()
 
@@ -68,66 +90,32 @@ func (c *Client) Read() {
 
 		switch action {
 		case "join":
-			isValid := true
-			requiredFields := []string{"userId", "username", "profilePic"}
-			for _, field := range requiredFields {
-				if _, exists := data[field]; !exists {
-					isValid = false
-					break
-				}
-			}
-
-			if !isValid {
-				c.Conn.WriteJSON(Message{Error: "Invalid request body"})
+			if c.IsSpectator {
+				c.Conn.WriteJSON(Message{Error: "Spectators cannot join the game"})
 				break
 			}
 
-			c.ID = data["userId"].(string)
-
-			// check if player is already in the game
-			isInGame := false
-			for _, p := range c.Pool.Game.Players {
-				if p.PlayerId == c.ID {
-					isInGame = true
-					break
-				}
-			}
-
-			if isInGame {
-				c.Pool.Game.Reconnect <- c.ID
-				break
-			}
-
-			// add player to the game
-			newPlayer := &Player{
-				Status:          "waiting",
-				Cards:           []Card{},
-				IsOut:           false,
+			// joining again reconnects a player that is already in the game
+			err := c.Pool.Game.Do(Engine.Join{
 				PlayerId:        c.ID,
-				PlayerName:      data["username"].(string),
-				PlayerAvatarURL: data["profilePic"].(string),
+				PlayerName:      c.Name,
+				PlayerAvatarURL: c.AvatarURL,
+			})
+			if err != nil {
+				c.Conn.WriteJSON(Message{Error: gameErrorMessage(err)})
 			}
-			c.Pool.Game.Register <- newPlayer
 			break
 		case "start":
 			fmt.Println("start")
-			if c.Pool.Game.Status != "waiting" {
-				c.Conn.WriteJSON(Message{Error: "Game has already started"})
-				break
-			}
-
-			if len(c.Pool.Game.Players) < 2 {
-				c.Conn.WriteJSON(Message{Error: "Not enough players"})
-				break
-			}
-
 			if c.ID != c.Pool.OwnerId {
 				c.Conn.WriteJSON(Message{Error: "Only owner can start the game"})
 				break
 			}
 
-			c.Pool.Game.StartGame <- true
-
+			err := c.Pool.Game.Do(Engine.Start{})
+			if err != nil {
+				c.Conn.WriteJSON(Message{Error: gameErrorMessage(err)})
+			}
 			break
 		case "play":
 			cardData, exists := data["card"]
@@ -138,15 +126,42 @@ func (c *Client) Read() {
 
 			jsonData, _ := json.Marshal(cardData)
 
-			var card Card
+			var card Engine.Card
 			json.Unmarshal(jsonData, &card)
 
-			if !c.Pool.Game.isValidPlay(c.ID, card) {
-				c.Conn.WriteJSON(Message{Error: "Invalid play"})
+			// choose cards need a choice, target cards a target
+			play := Engine.PlayCard{PlayerId: c.ID, Card: card}
+			if choice, ok := data["choice"].(float64); ok {
+				play.Choice = int(choice)
+			}
+			if targetId, ok := data["targetId"].(string); ok {
+				play.TargetId = targetId
+			}
+
+			err := c.Pool.Game.Do(play)
+			if err != nil {
+				fmt.Println("invalid play:", err)
+				c.Conn.WriteJSON(Message{Error: playErrorMessage(err)})
+			}
+			break
+		case "addBot", "removeBot":
+			if c.ID != c.Pool.OwnerId {
+				c.Conn.WriteJSON(Message{Error: "Only owner can add or remove bots"})
 				break
 			}
 
-			c.Pool.Game.cardPlayed <- card
+			errMsg := ""
+			if action == "addBot" {
+				strategy, _ := data["strategy"].(string)
+				errMsg = c.addBot(strategy)
+			} else {
+				playerId, _ := data["playerId"].(string)
+				errMsg = c.removeBot(playerId)
+			}
+
+			if errMsg != "" {
+				c.Conn.WriteJSON(Message{Error: errMsg})
+			}
 			break
 		case "leave":
 			fmt.Println("leave")
@@ -157,3 +172,88 @@ func (c *Client) Read() {
 
 	}
 }
+
+// gameErrorMessage is the error sent to a client whose action was rejected
+func gameErrorMessage(err error) string {
+	switch err {
+	case Engine.ErrGameStarted:
+		return "Game has already started"
+	case Engine.ErrNotEnoughPlayers:
+		return "Not enough players"
+	case Engine.ErrDeckTooSmall:
+		return "Not enough cards in the deck for every player"
+	case errGameStopped:
+		return "Game has ended"
+	}
+	return "Invalid request"
+}
+
+// addBot seats a bot, the seat is taken on the room first so humans joining
+// at the same time cannot overfill it. An empty strategy is the default one.
+func (c *Client) addBot(strategy string) string {
+	if strategy == "" {
+		strategy = Bot.DefaultStrategy
+	}
+
+	if _, exists := Bot.Strategies[strategy]; !exists {
+		return "Unknown bot strategy"
+	}
+
+	_, err, errMsg := Room.AddBotSeat(c.ID, c.Pool.RoomId)
+	if err != nil {
+		fmt.Println("bot seat:", err)
+	}
+	if errMsg != "" {
+		return errMsg
+	}
+
+	err = c.Pool.Game.AddBot(strategy)
+	if err != nil {
+		if err := Room.RemoveBotSeats(c.Pool.RoomId, 1); err != nil {
+			fmt.Println("bot seat:", err)
+		}
+		return botErrorMessage(err)
+	}
+	return ""
+}
+
+// removeBot takes a bot out of the game and frees its seat
+func (c *Client) removeBot(playerId string) string {
+	err := c.Pool.Game.RemoveBot(playerId)
+	if err != nil {
+		return botErrorMessage(err)
+	}
+
+	if err := Room.RemoveBotSeats(c.Pool.RoomId, 1); err != nil {
+		fmt.Println("bot seat:", err)
+	}
+	return ""
+}
+
+// botErrorMessage is the error sent to an owner whose bot could not be added
+// or removed
+func botErrorMessage(err error) string {
+	switch err {
+	case errUnknownStrategy:
+		return "Unknown bot strategy"
+	case errNotABot:
+		return "Player is not a bot"
+	case Engine.ErrGameStarted, Engine.ErrNotPlaying, errGameStopped:
+		return gameErrorMessage(err)
+	}
+	fmt.Println("bot:", err)
+	return "Invalid request"
+}
+
+// playErrorMessage is the error sent to a client whose play was rejected
+func playErrorMessage(err error) string {
+	switch err {
+	case Engine.ErrInvalidChoice:
+		return "Choose card must be played as 10 or -10"
+	case Engine.ErrInvalidTarget:
+		return "Target must be another player still in the game"
+	case errGameStopped:
+		return "Game has ended"
+	}
+	return "Invalid play"
+}
@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"time"
+
+	Store "ninetynine/store"
+)
+
+// turnClock times the turns of a game. A player gets the turn time, then
+// whatever is left of their time bank, before their turn times out. It is
+// only changed by the game goroutine, under the game lock.
+type turnClock struct {
+	turn      time.Duration // 0 when turns are not timed
+	bank      time.Duration // every player's bank at the start of the game
+	banks     map[string]time.Duration
+	playerId  string // whose turn is running, "" between turns
+	startedAt time.Time
+	timer     *time.Timer
+}
+
+func newTurnClock(rules Store.RoomRules) turnClock {
+	return turnClock{
+		turn:  time.Duration(rules.TurnSeconds) * time.Second,
+		bank:  time.Duration(rules.TimeBankSeconds) * time.Second,
+		banks: make(map[string]time.Duration),
+	}
+}
+
+// start ends the running turn and starts the turn of playerId
+func (c *turnClock) start(playerId string, now time.Time) {
+	c.stop(now)
+	if c.turn == 0 {
+		return
+	}
+
+	c.playerId = playerId
+	c.startedAt = now
+	c.timer = time.NewTimer(c.turn + c.bankOf(playerId))
+}
+
+// stop ends the running turn, charging the time over the turn time to the
+// player's bank
+func (c *turnClock) stop(now time.Time) {
+	if c.playerId == "" {
+		return
+	}
+
+	c.timer.Stop()
+	c.banks[c.playerId] = c.bankLeft(c.playerId, now)
+	c.playerId = ""
+	c.timer = nil
+}
+
+// expired fires when the running turn times out, it is nil between turns
+func (c *turnClock) expired() <-chan time.Time {
+	if c.timer == nil {
+		return nil
+	}
+	return c.timer.C
+}
+
+// turnLeft is what is left of the turn time, without the bank
+func (c *turnClock) turnLeft(now time.Time) time.Duration {
+	if c.playerId == "" {
+		return 0
+	}
+	return positive(c.turn - now.Sub(c.startedAt))
+}
+
+// bankLeft is what is left of a player's bank, counting the running turn
+func (c *turnClock) bankLeft(playerId string, now time.Time) time.Duration {
+	bank := c.bankOf(playerId)
+	if playerId != c.playerId {
+		return bank
+	}
+	return positive(bank - positive(now.Sub(c.startedAt)-c.turn))
+}
+
+func (c *turnClock) bankOf(playerId string) time.Duration {
+	if bank, exists := c.banks[playerId]; exists {
+		return bank
+	}
+	return c.bank
+}
+
+func positive(d time.Duration) time.Duration {
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// seconds rounds up, so a clock only shows 0 once it has run out
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -1,74 +1,110 @@
 package websocket
 
 import (
+	"errors"
 	"fmt"
-	"math/rand"
-	Room "ninetynine/room"
+	"sync"
 	"time"
+
+	Engine "ninetynine/engine"
+	Room "ninetynine/room"
+	Store "ninetynine/store"
 )
 
+var errGameStopped = errors.New("game stopped")
+
+// Deck is the composition every new game is dealt from
+var Deck = Engine.DefaultDeck
+
+// Game runs the engine for a room. Actions from every client go through one
+// goroutine, which applies them and turns the engine events into broadcasts
+// and room updates.
 type Game struct {
-	Players            []*Player
-	Status             string
-	CurrentPlayerIndex int
-	CurrentDirection   int
-	StackValue         int
-	MaxStackValue      int
-	CardPerPlayer      int
-	LastPlayedCard     Card
-	Register           chan *Player
-	Reconnect          chan string
-	Unregister         chan string
-	cardPlayed         chan Card
-	StartGame          chan bool
-	Stop               chan bool
-	Pool               *Pool
+	mu        sync.RWMutex
+	state     Engine.State
+	rules     Store.RoomRules // the rules as the room stores them, for clients
+	clock     turnClock
+	bots      map[string]botPlayer // by player id
+	botCount  int
+	botTimer  *time.Timer
+	botRNG    Engine.RNG
+	botWake   chan struct{}
+	StartedAt int64
+	actions   chan actionRequest
+	Stop      chan bool
+	done      chan struct{}
+	Pool      *Pool
 }
 
-type Player struct {
-	Status          string
-	Cards           []Card
-	IsOut           bool
-	PlayerId        string
-	PlayerName      string
-	PlayerAvatarURL string
+type actionRequest struct {
+	action Engine.Action
+	check  func(state Engine.State) error // optional, runs against the state the action applies to
+	result chan error
 }
 
-type Card struct {
-	Value     int  `json:"value"`
-	IsSpecial bool `json:"isSpecial"`
-}
+func NewGame(rules Store.RoomRules) *Game {
+	state := Engine.NewState(Engine.NewRNG(uint64(time.Now().UnixNano())))
+	state.Deck = Deck
+	state.Rules = Room.GameRules(rules)
 
-func NewGame() *Game {
 	return &Game{
-		Players:            []*Player{},
-		Status:             "waiting",
-		CurrentPlayerIndex: 0,
-		CurrentDirection:   1,
-		StackValue:         0,
-		MaxStackValue:      99,
-		CardPerPlayer:      3,
-		LastPlayedCard: Card{
-			Value:     -1,
-			IsSpecial: true,
-		}, // empty card
-		Register:   make(chan *Player),
-		Reconnect:  make(chan string),
-		Unregister: make(chan string),
-		cardPlayed: make(chan Card),
-		StartGame:  make(chan bool),
-		Stop:       make(chan bool),
+		state:   state,
+		rules:   rules,
+		bots:    make(map[string]botPlayer),
+		botRNG:  Engine.NewRNG(uint64(time.Now().UnixNano()) + 1),
+		botWake: make(chan struct{}),
+		actions: make(chan actionRequest),
+		Stop:    make(chan bool),
+		done:    make(chan struct{}),
+	}
+}
+
+// Do applies an action in the game goroutine and returns the engine error
+func (game *Game) Do(action Engine.Action) error {
+	return game.doChecked(action, nil)
+}
+
+// doChecked applies an action only if check passes, nothing can change the
+// state between the two
+func (game *Game) doChecked(action Engine.Action, check func(state Engine.State) error) error {
+	request := actionRequest{action: action, check: check, result: make(chan error, 1)}
+	select {
+	case game.actions <- request:
+		return <-request.result
+	case <-game.done:
+		return errGameStopped
 	}
 }
 
+// SetRules changes the rules while the game is waiting for players
+func (game *Game) SetRules(rules Store.RoomRules) error {
+	err := game.Do(Engine.SetRules{Rules: Room.GameRules(rules)})
+	if err != nil {
+		return err
+	}
+
+	game.mu.Lock()
+	game.rules = rules
+	game.mu.Unlock()
+	return nil
+}
+
+// State returns a snapshot of the engine state
+func (game *Game) State() Engine.State {
+	game.mu.RLock()
+	defer game.mu.RUnlock()
+	return game.state
+}
+
 func (game *Game) Start() {
 	defer func() {
 		fmt.Println("game stopped")
-		game.Pool.GameAction <- "game ended"
-		Room.FirebaseUpdateChannel[game.Pool.RoomId] <- Room.FirebaseUpdateData{
-			Field: "status",
-			Value: game.Status,
+		close(game.done)
+		game.Pool.gameAction("game ended")
+		if game.State().Status == Engine.StatusEnded {
+			Room.SaveMatch(game.matchResult())
 		}
+		Room.UpdateStatus(game.Pool.RoomId, game.State().Status)
 	}()
 
 	for {
@@ -78,218 +114,231 @@ func (game *Game) Start() {
 				return
 			}
 
-		case player := <-game.Register:
-			game.Players = append(game.Players, player)
-			fmt.Println("register player", player.PlayerId)
-			game.Pool.GameAction <- fmt.Sprintf("player %v joined", player.PlayerName)
-			break
-
-		case playerId := <-game.Reconnect:
-			fmt.Println("reconnect player", playerId)
-			for _, p := range game.Players {
-				if p.PlayerId == playerId {
-					fmt.Println("reconnect player from the game", p.PlayerId)
-					game.Pool.GameAction <- fmt.Sprintf("player %v reconnect", p.PlayerName)
+		case request := <-game.actions:
+			if request.check != nil {
+				if err := request.check(game.State()); err != nil {
+					request.result <- err
 					break
 				}
 			}
-			break
-
-		case playerId := <-game.Unregister:
-			if game.Status == "playing" || game.Status == "ended" {
-				for _, p := range game.Players {
-					if p.PlayerId == playerId {
-						p.IsOut = true
-						p.Status = "left"
-						fmt.Println("unregister player from the game", p.PlayerId)
-						game.Pool.GameAction <- fmt.Sprintf("player %v left", p.PlayerName)
-						break
-					}
-				}
 
-				if playerId == game.Players[game.CurrentPlayerIndex].PlayerId {
-					game.NextPlayer()
-				} else {
-					if game.IsGameEnded() {
-						game.Status = "ended"
-						fmt.Println("game ended")
-						go func() {
-							game.Stop <- true
-						}()
-						return
-					}
-				}
+			events, err := game.apply(request.action)
+			request.result <- err
+			if err != nil {
 				break
 			}
 
-			if game.Status == "waiting" {
-				for i, p := range game.Players {
-					if p.PlayerId == playerId {
-						game.Players = append(game.Players[:i], game.Players[i+1:]...)
-						fmt.Println("unregister player from the game", p.PlayerId)
-						game.Pool.GameAction <- fmt.Sprintf("player %v left", p.PlayerName)
-						break
-					}
-				}
-			}
-			break
-
-		case _ = <-game.StartGame:
-			game.Status = "playing"
-			for _, p := range game.Players {
-				p.Cards = []Card{}
-				p.Status = "playing"
-				for i := 0; i < game.CardPerPlayer; i++ {
-					p.Cards = append(p.Cards, randomCard())
-				}
+			if game.handleEvents(events) {
+				return
 			}
+			game.scheduleBot()
 
-			game.Pool.GameAction <- "game started"
-			Room.FirebaseUpdateChannel[game.Pool.RoomId] <- Room.FirebaseUpdateData{
-				Field: "status",
-				Value: game.Status,
+		case <-game.clock.expired():
+			events, err := game.apply(Engine.Timeout{PlayerId: game.clock.playerId})
+			if err != nil {
+				fmt.Println("turn timeout:", err)
+				break
 			}
-			if !game.CanCurrentPlayerPlay() {
-				game.NextPlayer()
+
+			if game.handleEvents(events) {
+				return
 			}
-		case card := <-game.cardPlayed:
-			fmt.Println("card played", card)
-			game.LastPlayedCard = card
-			player := game.Players[game.CurrentPlayerIndex]
-			game.PlayCard(card)
-			game.NextPlayer()
-
-			if !game.IsGameEnded() {
-				game.Pool.GameAction <- fmt.Sprintf("player %v played Card%v", player.PlayerName, card)
+			game.scheduleBot()
+
+		case <-game.botMove():
+			action, ok := game.playBot()
+			if !ok {
+				break
 			}
-			break
-		}
 
-	}
-}
+			events, err := game.apply(action)
+			if err != nil {
+				fmt.Println("bot play:", err)
+				break
+			}
 
-func (game *Game) PlayCard(card Card) {
-	if !card.IsSpecial {
-		game.StackValue += card.Value
-	} else {
-		switch card.Value {
-		case 0:
-			break
-		case 1:
-			game.CurrentDirection *= -1
-			break
-		case 2:
-			game.shufflePlayer()
-			break
-		case 3:
-			game.StackValue = game.MaxStackValue
-			break
-		}
-	}
+			if game.handleEvents(events) {
+				return
+			}
+			game.scheduleBot()
 
-	// find card index and change it to new card
-	for i, c := range game.Players[game.CurrentPlayerIndex].Cards {
-		if c.Value == card.Value && c.IsSpecial == card.IsSpecial {
-			game.Players[game.CurrentPlayerIndex].Cards[i] = randomCard()
-			break
+		case <-game.botWake:
+			game.scheduleBot()
 		}
 	}
 }
 
-func (game *Game) NextPlayer() {
-	game.CurrentPlayerIndex += game.CurrentDirection
-	if game.CurrentPlayerIndex < 0 {
-		game.CurrentPlayerIndex = len(game.Players) - 1
-	} else if game.CurrentPlayerIndex >= len(game.Players) {
-		game.CurrentPlayerIndex = 0
-	}
+// apply runs an action through the engine and restarts the turn clock when
+// the turn moved on
+func (game *Game) apply(action Engine.Action) ([]Engine.Event, error) {
+	game.mu.Lock()
+	defer game.mu.Unlock()
 
-	for range game.Players {
-		if game.IsGameEnded() {
-			fmt.Println("game ended")
-			game.Status = "ended"
-			go func() {
-				game.Stop <- true
-			}()
-			return
-		}
-
-		if game.CanCurrentPlayerPlay() {
-			break
-		}
-
-		if !game.Players[game.CurrentPlayerIndex].IsOut {
-			fmt.Println("player", game.Players[game.CurrentPlayerIndex].PlayerName, "is out")
-			game.Players[game.CurrentPlayerIndex].IsOut = true
-			game.Players[game.CurrentPlayerIndex].Status = "Out"
-			game.Pool.GameAction <- fmt.Sprintf("player %v is out", game.Players[game.CurrentPlayerIndex].PlayerName)
-		}
+	before := game.state
+	state, events, err := Engine.Apply(before, action)
+	if err != nil {
+		return nil, err
+	}
+	game.state = state
 
-		game.CurrentPlayerIndex += game.CurrentDirection
-		if game.CurrentPlayerIndex < 0 {
-			game.CurrentPlayerIndex = len(game.Players) - 1
-		} else if game.CurrentPlayerIndex >= len(game.Players) {
-			game.CurrentPlayerIndex = 0
-		}
+	now := time.Now()
+	if before.Status == Engine.StatusWaiting && state.Status == Engine.StatusPlaying {
+		game.clock = newTurnClock(game.rules)
+	}
 
+	switch {
+	case state.Status != Engine.StatusPlaying:
+		game.clock.stop(now)
+	case turnChanged(before, state, action):
+		game.clock.start(state.Players[state.CurrentPlayerIndex].PlayerId, now)
 	}
+	return events, nil
 }
 
-func (game *Game) IsGameEnded() bool {
-	return game.currentPlayerCount() == 1
+// turnChanged reports whether a new turn began, a player can get two turns
+// in a row
+func turnChanged(before Engine.State, after Engine.State, action Engine.Action) bool {
+	switch action.(type) {
+	case Engine.Start, Engine.PlayCard, Engine.Timeout:
+		return true
+	}
+	return before.Players[before.CurrentPlayerIndex].PlayerId != after.Players[after.CurrentPlayerIndex].PlayerId
 }
 
-func (game *Game) currentPlayerCount() int {
-	count := 0
-	for _, p := range game.Players {
-		if !p.IsOut {
-			count++
-		}
+// handleEvents broadcasts the events of an action and reports whether the
+// game is over
+func (game *Game) handleEvents(events []Engine.Event) bool {
+	for _, event := range events {
+		game.handleEvent(event)
 	}
-	return count
-}
 
-func (game *Game) CanCurrentPlayerPlay() bool {
-	if game.Players[game.CurrentPlayerIndex].IsOut {
-		return false
+	if game.State().Status == Engine.StatusEnded {
+		fmt.Println("game ended")
+		return true
 	}
+	return false
+}
 
-	for _, card := range game.Players[game.CurrentPlayerIndex].Cards {
-		if game.isValidPlay(game.Players[game.CurrentPlayerIndex].PlayerId, card) {
-			return true
+// handleEvent broadcasts an engine event, the end of the game is announced
+// when the game goroutine stops
+func (game *Game) handleEvent(event Engine.Event) {
+	switch event.Kind {
+	case Engine.PlayerJoined:
+		fmt.Println("register player", event.PlayerId)
+		game.Pool.gameAction(fmt.Sprintf("player %v joined", event.PlayerName))
+	case Engine.PlayerReconnected:
+		fmt.Println("reconnect player", event.PlayerId)
+		if game.handBack(event.PlayerId) {
+			fmt.Println("bot hands back to", event.PlayerId)
 		}
+		game.Pool.gameAction(fmt.Sprintf("player %v reconnect", event.PlayerName))
+	case Engine.PlayerLeft:
+		fmt.Println("unregister player from the game", event.PlayerId)
+		game.Pool.gameAction(fmt.Sprintf("player %v left", event.PlayerName))
+	case Engine.RulesChanged:
+		game.Pool.gameAction("rules changed")
+	case Engine.GameStarted:
+		game.StartedAt = time.Now().Unix()
+		game.Pool.gameAction("game started")
+		Room.UpdateStatus(game.Pool.RoomId, Engine.StatusPlaying)
+	case Engine.CardPlayed:
+		fmt.Println("card played", event.Card)
+		game.Pool.gameAction(fmt.Sprintf("player %v played Card%v", event.PlayerName, event.Card.Card))
+	case Engine.TurnTimedOut:
+		fmt.Println("player", event.PlayerName, "timed out")
+		game.Pool.gameAction(fmt.Sprintf("player %v timed out", event.PlayerName))
+	case Engine.PlayerSkipped:
+		game.Pool.gameAction(fmt.Sprintf("player %v skipped", event.PlayerName))
+	case Engine.LifeLost:
+		game.Pool.gameAction(fmt.Sprintf("player %v lost a life", event.PlayerName))
+	case Engine.PlayerEliminated:
+		game.Pool.gameAction(fmt.Sprintf("player %v is out of the match", event.PlayerName))
+	case Engine.RoundEnded:
+		fmt.Println("round", event.Round, "won by", event.PlayerName)
+		game.Pool.gameAction(fmt.Sprintf("round %v won by %v", event.Round, event.PlayerName))
+	case Engine.RoundStarted:
+		game.Pool.gameAction(fmt.Sprintf("round %v started", event.Round))
+	case Engine.StackReset:
+		game.Pool.gameAction("stack reset")
+	case Engine.DeckReshuffled:
+		game.Pool.gameAction("deck reshuffled")
+	case Engine.PlayerOut:
+		fmt.Println("player", event.PlayerName, "is out")
+		game.Pool.gameAction(fmt.Sprintf("player %v is out", event.PlayerName))
 	}
-	return false
 }
 
-func (game *Game) shufflePlayer() {
-	currentPlayerId := game.Players[game.CurrentPlayerIndex].PlayerId
-	players := game.Players
-	rand.NewSource(time.Now().UnixNano())
-	rand.Shuffle(len(players), func(i, j int) { players[i], players[j] = players[j], players[i] })
+// matchResult ranks the players of a finished game for the match history
+func (game *Game) matchResult() Store.Match {
+	state := game.State()
+	match := Store.Match{
+		RoomId:    game.Pool.RoomId,
+		StartedAt: game.StartedAt,
+		EndedAt:   time.Now().Unix(),
+		PlayerIds: []string{},
+		Players:   []Store.MatchPlayer{},
+	}
+
+	for _, standing := range Engine.Standings(state) {
+		if standing.Place == 1 {
+			match.WinnerId = standing.PlayerId
+		}
 
-	for i, p := range players {
-		if p.PlayerId == currentPlayerId {
-			game.CurrentPlayerIndex = i
-			break
+		// bots are not users, they are kept out of the lookups by player
+		isBot := game.isBot(standing.PlayerId)
+		if !isBot {
+			match.PlayerIds = append(match.PlayerIds, standing.PlayerId)
 		}
+		match.Players = append(match.Players, Store.MatchPlayer{
+			PlayerId:   standing.PlayerId,
+			PlayerName: standing.PlayerName,
+			Placement:  standing.Place,
+			IsBot:      isBot,
+		})
 	}
+
+	return match
 }
 
 func (game *Game) GetGameData(userId string) GameMessage {
+	now := time.Now()
+	game.mu.RLock()
+	state, rules := game.state, game.rules
+	turnTimeLeft := seconds(game.clock.turnLeft(now))
+	banks := make(map[string]int)
+	for _, p := range state.Players {
+		banks[p.PlayerId] = seconds(game.clock.bankLeft(p.PlayerId, now))
+	}
+	bots := make(map[string]botPlayer)
+	for playerId, bot := range game.bots {
+		bots[playerId] = bot
+	}
+	game.mu.RUnlock()
+
 	gameData := GameMessage{
 		Players:            []PlayerMessage{},
-		PlayerCards:        []Card{},
-		Status:             game.Status,
-		CurrentPlayerIndex: game.CurrentPlayerIndex,
-		CurrentDirection:   game.CurrentDirection,
-		StackValue:         game.StackValue,
-		MaxStackValue:      game.MaxStackValue,
-		LastPlayedCard:     game.LastPlayedCard,
+		PlayerCards:        []Engine.Card{},
+		Status:             state.Status,
+		CurrentPlayerIndex: state.CurrentPlayerIndex,
+		CurrentDirection:   state.CurrentDirection,
+		StackValue:         state.StackValue,
+		MaxStackValue:      state.Rules.TargetValue,
+		LastPlayedCard:     state.LastPlayedCard,
+		DrawPileSize:       len(state.DrawPile),
+		Rules:              rules,
+		TurnTimeLeft:       turnTimeLeft,
+		Round:              state.Round,
+		Standings:          Engine.Standings(state),
 	}
 
-	for _, p := range game.Players {
-		gameData.Players = append(gameData.Players, getPlayerData(*p))
+	for _, p := range state.Players {
+		playerData := getPlayerData(p)
+		playerData.TimeBank = banks[p.PlayerId]
+		if bot, exists := bots[p.PlayerId]; exists {
+			playerData.IsBot = !bot.takeover
+			playerData.TakenOver = bot.takeover
+		}
+		gameData.Players = append(gameData.Players, playerData)
 		if p.PlayerId == userId {
 			gameData.PlayerCards = p.Cards
 		}
@@ -298,7 +347,7 @@ func (game *Game) GetGameData(userId string) GameMessage {
 	return gameData
 }
 
-func getPlayerData(p Player) PlayerMessage {
+func getPlayerData(p Engine.Player) PlayerMessage {
 	return PlayerMessage{
 		PlayerId:        p.PlayerId,
 		PlayerName:      p.PlayerName,
@@ -307,63 +356,3 @@ func getPlayerData(p Player) PlayerMessage {
 		Status:          p.Status,
 	}
 }
-
-func (game *Game) isValidPlay(playerId string, card Card) bool {
-	// check if it's player turn
-	if game.Players[game.CurrentPlayerIndex].PlayerId != playerId {
-		fmt.Println("not player turn")
-		return false
-	}
-	// check if player has that card
-	hasCard := false
-	for _, c := range game.Players[game.CurrentPlayerIndex].Cards {
-		if c.Value == card.Value && c.IsSpecial == card.IsSpecial {
-			hasCard = true
-			break
-		}
-	}
-
-	if !hasCard {
-		fmt.Println("player doesn't have that card")
-		return false
-	}
-
-	// check if card is valid
-	if card.IsSpecial {
-		return true
-	}
-
-	// check if card value is valid
-	if card.Value+game.StackValue <= game.MaxStackValue {
-		return true
-	}
-
-	fmt.Println("card value is invalid")
-	return false
-}
-
-func randomCard() Card {
-	cardListLength := len(CardList)
-	rand.NewSource(time.Now().UnixNano())
-	index := rand.Intn(cardListLength)
-	return CardList[index]
-}
-
-var CardList = [16]Card{
-	{Value: 1, IsSpecial: false},
-	{Value: 2, IsSpecial: false},
-	{Value: 3, IsSpecial: false},
-	{Value: 4, IsSpecial: false},
-	{Value: 5, IsSpecial: false},
-	{Value: 6, IsSpecial: false},
-	{Value: 7, IsSpecial: false},
-	{Value: 8, IsSpecial: false},
-	{Value: 9, IsSpecial: false},
-	{Value: 10, IsSpecial: false},
-	{Value: -9, IsSpecial: false},
-	{Value: -10, IsSpecial: false},
-	{Value: 0, IsSpecial: true},
-	{Value: 1, IsSpecial: true},
-	{Value: 2, IsSpecial: true},
-	{Value: 3, IsSpecial: true},
-}
@@ -2,7 +2,10 @@ package websocket
 
 import (
 	"fmt"
+
+	Engine "ninetynine/engine"
 	Room "ninetynine/room"
+	Store "ninetynine/store"
 )
 
 type Pool struct {
@@ -14,12 +17,12 @@ type Pool struct {
 	RoomId     string
 	OwnerId    string
 	Game       *Game
+	done       chan struct{}
 }
 
-func NewPool(RoomId string, OwnerId string) *Pool {
-	newGame := NewGame()
-	go newGame.Start()
-	return &Pool{
+func NewPool(RoomId string, OwnerId string, rules Store.RoomRules) *Pool {
+	newGame := NewGame(rules)
+	pool := &Pool{
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
 		Clients:    make(map[*Client]bool),
@@ -28,19 +31,34 @@ func NewPool(RoomId string, OwnerId string) *Pool {
 		RoomId:     RoomId,
 		OwnerId:    OwnerId,
 		Game:       newGame,
+		done:       make(chan struct{}),
 	}
+
+	// the game reports to the pool, it has to know it before it runs
+	newGame.Pool = pool
+	go newGame.Start()
+	return pool
 }
 
 func (pool *Pool) Start() {
 	defer func() {
+		close(pool.done)
+
+		// bots only live in the game, a lobby that closes gives their seats back
+		if seats := pool.Game.BotSeats(); seats > 0 && pool.Game.State().Status == Engine.StatusWaiting {
+			if err := Room.RemoveBotSeats(pool.RoomId, seats); err != nil {
+				fmt.Println("bot seats:", err)
+			}
+		}
 		for client := range pool.Clients {
 			client.Conn.Close()
 		}
-		pool.Game.Stop <- true
+		select {
+		case pool.Game.Stop <- true:
+		case <-pool.Game.done:
+		}
 	}()
 
-	pool.Game.Pool = pool
-
 	for {
 		select {
 		case client := <-pool.Register:
@@ -49,12 +67,20 @@ func (pool *Pool) Start() {
 			break
 		case client := <-pool.Unregister:
 			delete(pool.Clients, client)
-			newOwner := Room.PlayerLeft(pool.RoomId, client.ID, client.ID == pool.OwnerId)
-			if newOwner != "" {
-				pool.OwnerId = newOwner
-			}
 
-			pool.Game.Unregister <- client.ID
+			// a player taken over by a bot keeps their seat in the room
+			if !client.IsSpectator && pool.Game.TakeOver(client.ID) {
+				fmt.Println("bot takes over for", client.ID)
+				pool.BroadCaseGameData(fmt.Sprintf("bot playing for %v", client.Name))
+			} else {
+				newOwner := Room.PlayerLeft(pool.RoomId, client.ID, client.ID == pool.OwnerId)
+				if newOwner != "" {
+					pool.OwnerId = newOwner
+				}
+
+				// the game may be waiting to broadcast, leave without blocking the pool
+				go pool.Game.Do(Engine.Leave{PlayerId: client.ID})
+			}
 			fmt.Println("Size of Connection Pool: ", len(pool.Clients))
 
 			if len(pool.Clients) == 0 {
@@ -75,6 +101,34 @@ func (pool *Pool) Start() {
 	}
 }
 
+// Join registers a client with the pool, it returns false once the pool has
+// stopped so the caller can start a new one
+func (pool *Pool) Join(client *Client) bool {
+	select {
+	case pool.Register <- client:
+		return true
+	case <-pool.done:
+		return false
+	}
+}
+
+// leave unregisters a client, a pool that stopped has already let it go
+func (pool *Pool) leave(client *Client) {
+	select {
+	case pool.Unregister <- client:
+	case <-pool.done:
+	}
+}
+
+// gameAction asks the pool to broadcast the game data, it is dropped once the
+// pool has stopped
+func (pool *Pool) gameAction(actionMessage string) {
+	select {
+	case pool.GameAction <- actionMessage:
+	case <-pool.done:
+	}
+}
+
 func (pool *Pool) BroadCaseGameData(actionMessage string) {
 	fmt.Println("broadcast game data", actionMessage)
 	for client := range pool.Clients {
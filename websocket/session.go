@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// closeSessionRevoked is the close code sent when the session of a
+// connection is revoked, clients should sign in again instead of reconnecting
+const closeSessionRevoked = 4001
+
+// connections tracks every open client across pools by session
+var connections = struct {
+	sync.Mutex
+	clients map[*Client]bool
+}{clients: make(map[*Client]bool)}
+
+func trackConnection(c *Client) {
+	connections.Lock()
+	defer connections.Unlock()
+	connections.clients[c] = true
+}
+
+func untrackConnection(c *Client) {
+	connections.Lock()
+	defer connections.Unlock()
+	delete(connections.clients, c)
+}
+
+// CloseSessions closes the connections opened with the revoked sessions of a
+// user, a nil sessionIds closes all of the user's connections
+func CloseSessions(userId string, sessionIds []string) {
+	revoked := make(map[string]bool)
+	for _, sessionId := range sessionIds {
+		revoked[sessionId] = true
+	}
+
+	connections.Lock()
+	defer connections.Unlock()
+
+	for c := range connections.clients {
+		if c.ID != userId || (sessionIds != nil && !revoked[c.SessionId]) {
+			continue
+		}
+
+		// Read sees the closed connection and unregisters the client
+		message := websocket.FormatCloseMessage(closeSessionRevoked, "Session revoked")
+		c.Conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+		c.Conn.Close()
+	}
+}
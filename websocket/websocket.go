@@ -7,10 +7,32 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// accessTokenProtocol lets browsers, which cannot set headers on a websocket,
+// send the access token as the subprotocol list ["access_token", <token>]
+const accessTokenProtocol = "access_token"
+
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 	CheckOrigin:     func(r *http.Request) bool { return true },
+	Subprotocols:    []string{accessTokenProtocol},
+}
+
+// AccessToken reads the access token from the "token" query parameter or
+// from the subprotocol list
+func AccessToken(r *http.Request) string {
+	if token := r.URL.Query().Get("token"); token != "" {
+		return token
+	}
+
+	protocols := websocket.Subprotocols(r)
+	for i, protocol := range protocols {
+		if protocol == accessTokenProtocol && i+1 < len(protocols) {
+			return protocols[i+1]
+		}
+	}
+
+	return ""
 }
 
 func Upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {